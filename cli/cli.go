@@ -1,17 +1,67 @@
 package cli
 
 import (
+	"errors"
 	"flag"
+	"github.com/gpestana/kapacitor-unit/io"
 	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Command that lists the tests instead of running them
+const List = "list"
+
 type Config struct {
+	// Command to run, empty to run the tests
+	Command string
 	//Path for test definitions YAML file
 	TestsPath string
 	// Path for directory where TICKscripts are
-	ScriptsDir    string
-	InfluxdbHost  string
-	KapacitorHost string
+	ScriptsDir string
+	// Host, credentials and TLS options of Kapacitor and InfluxDB
+	Kapacitor io.ClientConfig
+	Influxdb  io.ClientConfig
+	// Number of tests running at the same time
+	Parallel int
+	// Prefix of the ids of the Kapacitor tasks created by the tests
+	TaskPrefix string
+	// Maximum time to wait for a task to process the test data, for tests
+	// that do not define a timeout
+	Timeout time.Duration
+	// Maximum time to run the suite, after which the tests not started yet
+	// are skipped. Zero for no limit.
+	SuiteTimeout time.Duration
+	// Leaves tasks and databases in place after running the tests
+	KeepArtifacts bool
+	// Runs only the tests with a name matching the expression
+	Run *regexp.Regexp
+	// Runs only the tests with any of the tags
+	Tags []string
+	// Skips the tests with any of the tags
+	ExcludeTags []string
+	// Stops running tests after the first test that does not pass
+	FailFast bool
+	// Reruns the tests affected by changes in the TICKscripts and tests
+	Watch bool
+	// Validates the tests and prints the task definitions without contacting
+	// Kapacitor or InfluxDB
+	DryRun bool
+	// Runs only the tests of shard Shard (1 to Shards) of the suite
+	Shard  int
+	Shards int
+	// JSON report of a previous run, used to balance shards by test duration
+	Timings string
+	// Path of the JSON report written after running the tests
+	Report string
+	// Runs the tests in a random order, given by the seed
+	Shuffle bool
+	Seed    int64
+	// Number of times each test is run, to detect flaky tests
+	Count int
 }
 
 func Load() *Config {
@@ -19,20 +69,232 @@ func Load() *Config {
 		"InfluxDB host")
 	kapacitorHost := flag.String("kapacitor", "http://localhost:9092",
 		"Kapacitor host")
+	configPath := flag.String("config", "",
+		"YAML file with the url and credentials of Kapacitor and InfluxDB")
+	kapacitorUsername := flag.String("kapacitor-username", "", "Kapacitor username (env KAPACITOR_USERNAME)")
+	kapacitorPassword := flag.String("kapacitor-password", "", "Kapacitor password (env KAPACITOR_PASSWORD)")
+	kapacitorToken := flag.String("kapacitor-token", "", "Kapacitor bearer token (env KAPACITOR_TOKEN)")
+	influxdbUsername := flag.String("influxdb-username", "", "InfluxDB username (env INFLUXDB_USERNAME)")
+	influxdbPassword := flag.String("influxdb-password", "", "InfluxDB password (env INFLUXDB_PASSWORD)")
+	influxdbToken := flag.String("influxdb-token", "", "InfluxDB bearer token (env INFLUXDB_TOKEN)")
+	kapacitorCA := flag.String("kapacitor-ca", "", "CA bundle verifying the Kapacitor certificate (env KAPACITOR_CA)")
+	kapacitorCert := flag.String("kapacitor-cert", "", "Client certificate for Kapacitor (env KAPACITOR_CERT)")
+	kapacitorKey := flag.String("kapacitor-key", "", "Client certificate key for Kapacitor (env KAPACITOR_KEY)")
+	kapacitorInsecure := flag.Bool("kapacitor-insecure-skip-verify", false,
+		"Do not verify the Kapacitor certificate (env KAPACITOR_INSECURE_SKIP_VERIFY)")
+	influxdbCA := flag.String("influxdb-ca", "", "CA bundle verifying the InfluxDB certificate (env INFLUXDB_CA)")
+	influxdbCert := flag.String("influxdb-cert", "", "Client certificate for InfluxDB (env INFLUXDB_CERT)")
+	influxdbKey := flag.String("influxdb-key", "", "Client certificate key for InfluxDB (env INFLUXDB_KEY)")
+	influxdbInsecure := flag.Bool("influxdb-insecure-skip-verify", false,
+		"Do not verify the InfluxDB certificate (env INFLUXDB_INSECURE_SKIP_VERIFY)")
+	influxdbVersion := flag.Int("influxdb-version", 1,
+		"Major version of the InfluxDB API: 1, or 2 to use buckets mapped to the test databases (env INFLUXDB_VERSION)")
+	influxdbOrg := flag.String("influxdb-org", "", "InfluxDB 2.x organization (env INFLUXDB_ORG)")
 	testsPath := flag.String("tests", "", "Tests definition file")
 	scriptsDir := flag.String("dir", "", "TICKscripts directory")
+	taskPrefix := flag.String("task-prefix", "kapacitor-unit",
+		"Prefix of the Kapacitor task ids, which are <prefix>-<run id>-<test index>")
+	timeout := flag.Duration("timeout", 30*time.Second,
+		"Maximum time to wait for a task to process the data of each test, unless the test defines a timeout")
+	suiteTimeout := flag.Duration("suite-timeout", 0,
+		"Maximum time to run the suite, after which the tests not started yet are skipped (0 for no limit)")
+	keepArtifacts := flag.Bool("keep-artifacts", false,
+		"Leave the tasks and databases created by the tests in place and print their ids")
+	run := flag.String("run", "", "Run only the tests with a name matching the regular expression")
+	tags := flag.String("tags", "", "Run only the tests with any of the comma separated tags")
+	excludeTags := flag.String("exclude-tags", "", "Skip the tests with any of the comma separated tags")
+	failFast := flag.Bool("fail-fast", false, "Stop running tests after the first test that does not pass")
+	watch := flag.Bool("watch", false,
+		"Watch the TICKscripts and tests definitions, and rerun the tests affected by changes")
+	dryRun := flag.Bool("dry-run", false,
+		"Validate the tests and print the task definitions sent to Kapacitor, without running the tests")
+	shard := flag.String("shard", "",
+		"Run only the tests of shard i of n (i/n), to split the suite across machines")
+	timings := flag.String("timings", "",
+		"JSON report of a previous run, used to balance shards by test duration")
+	report := flag.String("report", "", "Write the results of the tests to a JSON report file")
+	shuffle := flag.Bool("shuffle", false, "Run the tests in a random order, printing the seed of the order")
+	seed := flag.Int64("seed", 0, "Seed of the random order of the tests, to reproduce a shuffled run (implies --shuffle)")
+	count := flag.Int("count", 1, "Run each test N times and report the tests whose outcome differs between runs")
+	parallel := flag.Int("parallel", 1,
+		"Number of tests running in parallel, each with its own task and database")
+
+	// The list command precedes the flags (e.g. kapacitor-unit list --tests t.yaml)
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == List {
+		command = List
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	if flag.NArg() > 0 {
+		log.Fatal("ERROR: Unknown command: ", flag.Arg(0))
+	}
 
-	flag.Parse()
+	// Services options set by flags take precedence over environment
+	// variables, which take precedence over the configuration file
+	file, err := loadConfigFile(*configPath)
+	if err != nil {
+		log.Fatal("ERROR: Invalid configuration file (--config): ", err)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	kapacitor := file.Kapacitor
+	influxdb := file.Influxdb
+	*kapacitorHost = resolve(set, "kapacitor", *kapacitorHost, "KAPACITOR_URL", kapacitor.Url)
+	*influxdbHost = resolve(set, "influxdb", *influxdbHost, "INFLUXDB_URL", influxdb.Url)
+	kapacitorAuth := io.Auth{
+		Username: resolve(set, "kapacitor-username", *kapacitorUsername, "KAPACITOR_USERNAME", kapacitor.Username),
+		Password: resolve(set, "kapacitor-password", *kapacitorPassword, "KAPACITOR_PASSWORD", kapacitor.Password),
+		Token:    resolve(set, "kapacitor-token", *kapacitorToken, "KAPACITOR_TOKEN", kapacitor.Token),
+	}
+	influxdbAuth := io.Auth{
+		Username: resolve(set, "influxdb-username", *influxdbUsername, "INFLUXDB_USERNAME", influxdb.Username),
+		Password: resolve(set, "influxdb-password", *influxdbPassword, "INFLUXDB_PASSWORD", influxdb.Password),
+		Token:    resolve(set, "influxdb-token", *influxdbToken, "INFLUXDB_TOKEN", influxdb.Token),
+	}
+	kapacitorSkipVerify, err := resolveBool(set, "kapacitor-insecure-skip-verify", *kapacitorInsecure,
+		"KAPACITOR_INSECURE_SKIP_VERIFY", kapacitor.InsecureSkipVerify)
+	if err != nil {
+		log.Fatal("ERROR: Invalid Kapacitor TLS option: ", err)
+	}
+	influxdbSkipVerify, err := resolveBool(set, "influxdb-insecure-skip-verify", *influxdbInsecure,
+		"INFLUXDB_INSECURE_SKIP_VERIFY", influxdb.InsecureSkipVerify)
+	if err != nil {
+		log.Fatal("ERROR: Invalid InfluxDB TLS option: ", err)
+	}
+	kapacitorTLS := io.TLS{
+		CA:                 resolve(set, "kapacitor-ca", *kapacitorCA, "KAPACITOR_CA", kapacitor.CA),
+		Cert:               resolve(set, "kapacitor-cert", *kapacitorCert, "KAPACITOR_CERT", kapacitor.Cert),
+		Key:                resolve(set, "kapacitor-key", *kapacitorKey, "KAPACITOR_KEY", kapacitor.Key),
+		InsecureSkipVerify: kapacitorSkipVerify,
+	}
+	influxdbTLS := io.TLS{
+		CA:                 resolve(set, "influxdb-ca", *influxdbCA, "INFLUXDB_CA", influxdb.CA),
+		Cert:               resolve(set, "influxdb-cert", *influxdbCert, "INFLUXDB_CERT", influxdb.Cert),
+		Key:                resolve(set, "influxdb-key", *influxdbKey, "INFLUXDB_KEY", influxdb.Key),
+		InsecureSkipVerify: influxdbSkipVerify,
+	}
+	org := resolve(set, "influxdb-org", *influxdbOrg, "INFLUXDB_ORG", influxdb.Org)
+	fileVersion := ""
+	if influxdb.Version != 0 {
+		fileVersion = strconv.Itoa(influxdb.Version)
+	}
+	version, err := strconv.Atoi(resolve(set, "influxdb-version", strconv.Itoa(*influxdbVersion),
+		"INFLUXDB_VERSION", fileVersion))
+	if err != nil || (version != 1 && version != 2) {
+		log.Fatal("ERROR: InfluxDB version (--influxdb-version) must be 1 or 2")
+	}
+	// Listing and dry runs do not connect to InfluxDB
+	if version == 2 && command != List && !*dryRun && (org == "" || influxdbAuth.Token == "") {
+		log.Fatal("ERROR: InfluxDB 2.x requires an organization (--influxdb-org) and a token (--influxdb-token)")
+	}
+	if kapacitorAuth.Token != "" && kapacitorAuth.Username != "" {
+		log.Fatal("ERROR: Kapacitor credentials must be either a username and password or a token")
+	}
+	if influxdbAuth.Token != "" && influxdbAuth.Username != "" {
+		log.Fatal("ERROR: InfluxDB credentials must be either a username and password or a token")
+	}
 
 	if *testsPath == "" {
 		log.Fatal("ERROR: Path for tests definitions (--tests) must be defined")
 	}
 
-	if *scriptsDir == "" {
+	// Listing tests does not read the TICKscripts
+	if *scriptsDir == "" && command != List {
 		log.Fatal("ERROR: Path for where TICKscripts directory (--dir) must be defined")
 	}
 
-	config := Config{*testsPath, *scriptsDir, *influxdbHost, *kapacitorHost}
+	if !regexp.MustCompile(`^[-\._\p{L}0-9]+$`).MatchString(*taskPrefix) {
+		log.Fatal("ERROR: Task id prefix (--task-prefix) must contain only letters, numbers, '-', '.' and '_'")
+	}
+
+	if *parallel < 1 {
+		log.Fatal("ERROR: Number of parallel tests (--parallel) must be at least 1")
+	}
+
+	if *count < 1 {
+		log.Fatal("ERROR: Number of runs (--count) must be at least 1")
+	}
+
+	runRegexp, err := regexp.Compile(*run)
+	if err != nil {
+		log.Fatal("ERROR: Invalid tests name expression (--run): ", err)
+	}
+
+	shardIndex, shards := 1, 1
+	if *shard != "" {
+		shardIndex, shards, err = parseShard(*shard)
+		if err != nil {
+			log.Fatal("ERROR: Invalid shard (--shard): ", err)
+		}
+	}
+
+	if *seed != 0 {
+		*shuffle = true
+	} else if *shuffle {
+		*seed = time.Now().UnixNano()
+	}
+
+	config := Config{
+		Command:       command,
+		TestsPath:     *testsPath,
+		ScriptsDir:    *scriptsDir,
+		Kapacitor:     io.ClientConfig{Host: *kapacitorHost, Auth: kapacitorAuth, TLS: kapacitorTLS},
+		Influxdb:      io.ClientConfig{Host: *influxdbHost, Auth: influxdbAuth, TLS: influxdbTLS, Org: org, Version: version},
+		Parallel:      *parallel,
+		TaskPrefix:    *taskPrefix,
+		Timeout:       *timeout,
+		SuiteTimeout:  *suiteTimeout,
+		KeepArtifacts: *keepArtifacts,
+		Run:           runRegexp,
+		Tags:          splitList(*tags),
+		ExcludeTags:   splitList(*excludeTags),
+		FailFast:      *failFast,
+		Watch:         *watch,
+		DryRun:        *dryRun,
+		Shard:         shardIndex,
+		Shards:        shards,
+		Timings:       *timings,
+		Report:        *report,
+		Shuffle:       *shuffle,
+		Seed:          *seed,
+		Count:         *count,
+	}
 
 	return &config
 }
+
+// Parses a shard definition i/n, where i is between 1 and n
+func parseShard(s string) (int, int, error) {
+	p := strings.Split(s, "/")
+	if len(p) != 2 {
+		return 0, 0, errors.New("shard must be defined as i/n")
+	}
+	i, err := strconv.Atoi(p[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.Atoi(p[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 1 || i < 1 || i > n {
+		return 0, 0, errors.New("shard i/n must have 1 <= i <= n")
+	}
+	return i, n, nil
+}
+
+// Splits a comma separated list, ignoring empty elements
+func splitList(s string) []string {
+	l := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
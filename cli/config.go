@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// Configuration file of the Kapacitor and InfluxDB services (--config), e.g.
+//
+//	kapacitor:
+//	  url: https://kapacitor:9092
+//	  username: kapacitor-unit
+//	  password: secret
+//	  ca: /etc/ssl/kapacitor-ca.pem
+//	influxdb:
+//	  url: https://influxdb:8086
+//	  token: secret
+//	  cert: /etc/ssl/client.pem
+//	  key: /etc/ssl/client-key.pem
+type fileConfig struct {
+	Kapacitor serviceConfig
+	Influxdb  serviceConfig
+}
+
+type serviceConfig struct {
+	Url                string
+	Username           string
+	Password           string
+	Token              string
+	CA                 string `yaml:"ca"`
+	Cert               string
+	Key                string
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// InfluxDB 2.x organization and API version
+	Org     string
+	Version int
+}
+
+// Reads the configuration file, if a path is given
+func loadConfigFile(path string) (fileConfig, error) {
+	c := fileConfig{}
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = yaml.UnmarshalStrict(b, &c)
+	return c, err
+}
+
+// Resolves an option from, in order of precedence, its flag if it was set,
+// its environment variable, the configuration file and the flag default
+func resolve(set map[string]bool, name string, flagValue string, env string, fileValue string) string {
+	if set[name] {
+		return flagValue
+	}
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if fileValue != "" {
+		return fileValue
+	}
+	return flagValue
+}
+
+// Resolves a boolean option like resolve. Fails if the environment variable
+// is set but is not a boolean.
+func resolveBool(set map[string]bool, name string, flagValue bool, env string, fileValue bool) (bool, error) {
+	if set[name] {
+		return flagValue, nil
+	}
+	if v := os.Getenv(env); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, errors.New(env + " must be true or false, got " + v)
+		}
+		return b, nil
+	}
+	return flagValue || fileValue, nil
+}
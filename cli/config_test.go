@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns the path of a configuration file with the given content, in a
+// temporary directory removed by the returned function
+func configFile(t *testing.T, c string) (string, func()) {
+	d, err := ioutil.TempDir("", "kapacitor-unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(d, "config.yaml")
+	if err := ioutil.WriteFile(p, []byte(c), 0644); err != nil {
+		os.RemoveAll(d)
+		t.Fatal(err)
+	}
+	return p, func() { os.RemoveAll(d) }
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	c := `
+kapacitor:
+  url: https://kapacitor:9092
+  username: user
+  password: pass
+  ca: ./ca.pem
+influxdb:
+  token: secret
+  insecure_skip_verify: true
+`
+	p, remove := configFile(t, c)
+	defer remove()
+	f, err := loadConfigFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Kapacitor.Url != "https://kapacitor:9092" || f.Kapacitor.Username != "user" ||
+		f.Kapacitor.Password != "pass" || f.Kapacitor.CA != "./ca.pem" ||
+		f.Influxdb.Token != "secret" || !f.Influxdb.InsecureSkipVerify {
+		t.Error("Configuration file not loaded as expected: ", f)
+	}
+}
+
+func TestLoadConfigFileUnknownKey(t *testing.T) {
+	p, remove := configFile(t, "kapacitor:\n  user: user\n")
+	defer remove()
+	if _, err := loadConfigFile(p); err == nil {
+		t.Error("Unknown configuration keys should fail to load")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	os.Setenv("KU_TEST_OPTION", "env")
+	defer os.Unsetenv("KU_TEST_OPTION")
+
+	set := map[string]bool{"option": true}
+	if v := resolve(set, "option", "flag", "KU_TEST_OPTION", "file"); v != "flag" {
+		t.Error("Flag should take precedence, got ", v)
+	}
+	if v := resolve(nil, "option", "default", "KU_TEST_OPTION", "file"); v != "env" {
+		t.Error("Environment variable should take precedence over the file, got ", v)
+	}
+	if v := resolve(nil, "option", "default", "KU_TEST_UNSET", "file"); v != "file" {
+		t.Error("Configuration file should take precedence over the default, got ", v)
+	}
+	if v := resolve(nil, "option", "default", "KU_TEST_UNSET", ""); v != "default" {
+		t.Error("Flag default should be used, got ", v)
+	}
+}
+
+func TestResolveBool(t *testing.T) {
+	os.Setenv("KU_TEST_BOOL", "true")
+	defer os.Unsetenv("KU_TEST_BOOL")
+
+	if v, _ := resolveBool(map[string]bool{"option": true}, "option", false, "KU_TEST_BOOL", true); v {
+		t.Error("Flag should take precedence")
+	}
+	if v, _ := resolveBool(nil, "option", false, "KU_TEST_BOOL", false); !v {
+		t.Error("Environment variable should take precedence over the file")
+	}
+	if v, _ := resolveBool(nil, "option", false, "KU_TEST_UNSET", true); !v {
+		t.Error("Configuration file should be used")
+	}
+}
+
+func TestResolveBoolInvalid(t *testing.T) {
+	os.Setenv("KU_TEST_BOOL", "yes please")
+	defer os.Unsetenv("KU_TEST_BOOL")
+
+	if _, err := resolveBool(nil, "option", false, "KU_TEST_BOOL", false); err == nil {
+		t.Error("Environment variable that is not a boolean should return error")
+	}
+}
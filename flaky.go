@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Reports the tests whose outcome differs between their count runs, and the
+// tests that only passed on a retry, with the number of runs of each outcome
+func flakyReport(tests TestCollection, count int) string {
+	l := []string{}
+	for _, t := range tests {
+		c := make(map[string]int)
+		for _, r := range t.Runs {
+			if o := outcome(r); o != skipped {
+				c[o]++
+			}
+		}
+		if len(c) < 2 && c[flakyPassed] == 0 {
+			continue
+		}
+		outcomes := []string{}
+		for o, n := range c {
+			outcomes = append(outcomes, fmt.Sprintf("%v %v", n, o))
+		}
+		sort.Strings(outcomes)
+		l = append(l, fmt.Sprintf("  %v (%v): %v", t.Name, t.File, strings.Join(outcomes, ", ")))
+	}
+	if len(l) == 0 {
+		return fmt.Sprintf("No flaky tests in %d runs", count)
+	}
+	return fmt.Sprintf("Flaky tests in %d runs:\n%v", count, strings.Join(l, "\n"))
+}
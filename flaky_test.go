@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/gpestana/kapacitor-unit/test"
+	"testing"
+)
+
+func TestFlakyReport(t *testing.T) {
+	tests := TestCollection{
+		{Name: "stable", File: "t.yaml", Runs: []test.Result{{Passed: true}, {Passed: true}}},
+		{Name: "flaky", File: "t.yaml", Runs: []test.Result{{Passed: true}, {}}},
+		{Name: "retried", File: "t.yaml", Runs: []test.Result{{Passed: true, Flaky: true}, {Passed: true}}},
+	}
+	exp := "Flaky tests in 2 runs:\n" +
+		"  flaky (t.yaml): 1 failed, 1 passed\n" +
+		"  retried (t.yaml): 1 flaky-passed, 1 passed"
+	if r := flakyReport(tests, 2); r != exp {
+		t.Error("Flaky report should be ", exp, " got ", r)
+	}
+}
+
+func TestFlakyReportStable(t *testing.T) {
+	tests := TestCollection{
+		{Name: "stable", Runs: []test.Result{{Passed: true}, {Passed: true}, {Skipped: true}}},
+	}
+	if r := flakyReport(tests, 3); r != "No flaky tests in 3 runs" {
+		t.Error("Unexpected flaky report: ", r)
+	}
+}
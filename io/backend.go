@@ -0,0 +1,57 @@
+package io
+
+// Loads and deletes Kapacitor tasks and templates
+type TaskLoader interface {
+	Load(f map[string]interface{}) error
+	Delete(id string) error
+	LoadTemplate(f map[string]interface{}) error
+	DeleteTemplate(id string) error
+}
+
+// Writes line protocol test data to a database and retention policy
+type DataWriter interface {
+	Data(data []string, db string, rp string) error
+}
+
+// Reads the alerts and node stats of a task
+type StatsReader interface {
+	Status(id string) (map[string]int, error)
+	NodeStats(id string) (map[string]map[string]int, error)
+}
+
+// Records test data, replays it against a task and reads the replay stats
+type Replayer interface {
+	RecordQuery(id string, typ string, query string) error
+	Replay(id string, task string, recording string, clock string) error
+	ReplayStats(id string) (map[string]map[string]int, error)
+	DeleteRecording(id string) error
+	DeleteReplay(id string) error
+}
+
+// Creates and deletes the databases of the tests
+type DatabaseAdmin interface {
+	Setup(db string, rp string) error
+	CleanUp(db string, rp string) error
+}
+
+// Service that runs the tasks under test, such as Kapacitor
+type TaskBackend interface {
+	TaskLoader
+	DataWriter
+	StatsReader
+	Replayer
+}
+
+// Database the test data is written to for batch and replayed tests, such as
+// InfluxDB
+type DataBackend interface {
+	DataWriter
+	DatabaseAdmin
+}
+
+// The HTTP clients are the default backends
+var (
+	_ TaskBackend = Kapacitor{}
+	_ DataBackend = Influxdb{}
+	_ DataBackend = Influxdb2{}
+)
@@ -0,0 +1,112 @@
+package io
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// Credentials of a service. The token, if defined, is sent as a bearer token
+// instead of the username and password.
+type Auth struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// TLS options of a service: the CA bundle verifying the server certificate,
+// the client certificate and key, and whether the server certificate is not
+// verified at all
+type TLS struct {
+	CA                 string
+	Cert               string
+	Key                string
+	InsecureSkipVerify bool
+}
+
+// Options of the clients of Kapacitor and InfluxDB
+type ClientConfig struct {
+	Host string
+	Auth Auth
+	TLS  TLS
+	// Major version of the InfluxDB API, 1 or 2, and organization of
+	// InfluxDB 2.x
+	Version int
+	Org     string
+}
+
+// Adds the credentials to every request. With params, the username and
+// password are sent as the u and p query parameters, as InfluxDB 1.x expects,
+// instead of with basic auth.
+type authTransport struct {
+	auth   Auth
+	params bool
+	base   http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Requests must not be modified by a RoundTripper
+	r = r.Clone(r.Context())
+	switch {
+	case t.auth.Token != "":
+		r.Header.Set("Authorization", "Bearer "+t.auth.Token)
+	case t.auth.Username != "" && t.params:
+		q := r.URL.Query()
+		q.Set("u", t.auth.Username)
+		q.Set("p", t.auth.Password)
+		r.URL.RawQuery = q.Encode()
+	case t.auth.Username != "":
+		r.SetBasicAuth(t.auth.Username, t.auth.Password)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// Returns the client of a service with the given credentials and TLS options
+func newClient(c ClientConfig, params bool) (http.Client, error) {
+	if c.Auth == (Auth{}) && c.TLS == (TLS{}) {
+		return http.Client{}, nil
+	}
+	var base http.RoundTripper = http.DefaultTransport
+	if c.TLS != (TLS{}) {
+		conf, err := tlsConfig(c.TLS)
+		if err != nil {
+			return http.Client{}, err
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = conf
+		base = t
+	}
+	if c.Auth == (Auth{}) {
+		return http.Client{Transport: base}, nil
+	}
+	return http.Client{Transport: authTransport{auth: c.Auth, params: params, base: base}}, nil
+}
+
+// Builds the TLS configuration of a client
+func tlsConfig(o TLS) (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CA != "" {
+		b, err := ioutil.ReadFile(o.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificates found in CA bundle " + o.CA)
+		}
+		conf.RootCAs = pool
+	}
+	if o.Cert != "" || o.Key != "" {
+		if o.Cert == "" || o.Key == "" {
+			return nil, errors.New("client certificate and key must be defined together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
@@ -0,0 +1,185 @@
+package io
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Server that saves the last request it received
+func recordingServer(last **http.Request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.WriteHeader(204)
+	}))
+}
+
+func TestKapacitorBasicAuth(t *testing.T) {
+	var r *http.Request
+	s := recordingServer(&r)
+	defer s.Close()
+
+	k, _ := NewKapacitorWithConfig(ClientConfig{Host: s.URL, Auth: Auth{Username: "user", Password: "pass"}})
+	err := k.Data([]string{"cpu value=1"}, "db", "rp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, p, ok := r.BasicAuth()
+	if !ok || u != "user" || p != "pass" {
+		t.Error("Request should use basic auth, got ", r.Header)
+	}
+}
+
+func TestKapacitorToken(t *testing.T) {
+	var r *http.Request
+	s := recordingServer(&r)
+	defer s.Close()
+
+	k, _ := NewKapacitorWithConfig(ClientConfig{Host: s.URL, Auth: Auth{Token: "secret"}})
+	err := k.Delete("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("Request should use a bearer token, got ", r.Header)
+	}
+}
+
+func TestInfluxdbParams(t *testing.T) {
+	var r *http.Request
+	s := recordingServer(&r)
+	defer s.Close()
+
+	i, _ := NewInfluxdbWithConfig(ClientConfig{Host: s.URL, Auth: Auth{Username: "user", Password: "pass"}})
+	err := i.Data([]string{"cpu value=1"}, "db", "rp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := r.URL.Query()
+	if q.Get("u") != "user" || q.Get("p") != "pass" || q.Get("db") != "db" || q.Get("rp") != "rp" {
+		t.Error("Request should send the credentials as query parameters, got ", r.URL)
+	}
+	if _, _, ok := r.BasicAuth(); ok {
+		t.Error("Request should not use basic auth")
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+		w.Write([]byte(`{"error":"authorization failed"}`))
+	}))
+	defer s.Close()
+
+	c := ClientConfig{Host: s.URL, Auth: Auth{Username: "user", Password: "wrong"}}
+	i, _ := NewInfluxdbWithConfig(c)
+	k, _ := NewKapacitorWithConfig(c)
+	errs := map[string]error{
+		"influxdb data":       i.Data([]string{"cpu value=1"}, "db", "rp"),
+		"influxdb setup":      i.Setup("db", "rp"),
+		"influxdb cleanup":    i.CleanUp("db", "rp"),
+		"kapacitor data":      k.Data([]string{"cpu value=1"}, "db", "rp"),
+		"kapacitor task":      k.Delete("task"),
+		"kapacitor template":  k.DeleteTemplate("template"),
+		"kapacitor replay":    k.DeleteReplay("replay"),
+		"kapacitor recording": k.DeleteRecording("recording"),
+	}
+	for n, err := range errs {
+		if err == nil || !strings.HasPrefix(err.Error(), "401 Unauthorized:: ") {
+			t.Error(n, ": wrong credentials should return the 401 error, got ", err)
+		}
+	}
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer s.Close()
+
+	k := NewKapacitor(s.URL)
+	err := k.Delete("task")
+	if err != nil {
+		t.Error("Deleting a missing task should succeed, got ", err)
+	}
+}
+
+func TestNoAuth(t *testing.T) {
+	var r *http.Request
+	s := recordingServer(&r)
+	defer s.Close()
+
+	i, _ := NewInfluxdbWithConfig(ClientConfig{Host: s.URL})
+	err := i.CleanUp("db", "rp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Get("Authorization") != "" || r.URL.Query().Get("u") != "" {
+		t.Error("Request should not be authenticated, got ", r.URL, r.Header)
+	}
+}
+
+// Writes the certificate of a TLS test server to a CA bundle file
+func writeCA(t *testing.T, s *httptest.Server, p string) {
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	var r *http.Request
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+	d, err := ioutil.TempDir("", "kapacitor-unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "ca.pem")
+	writeCA(t, s, p)
+
+	k, err := NewKapacitorWithConfig(ClientConfig{Host: s.URL, Auth: Auth{Token: "secret"}, TLS: TLS{CA: p}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Delete("task"); err != nil {
+		t.Error("Server certificate should be verified with the CA bundle: ", err)
+	}
+	if r == nil || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("Request should be authenticated over TLS")
+	}
+
+	k = NewKapacitor(s.URL)
+	if err := k.Delete("task"); err == nil {
+		t.Error("Server certificate should not be trusted without the CA bundle")
+	}
+
+	k, err = NewKapacitorWithConfig(ClientConfig{Host: s.URL, TLS: TLS{InsecureSkipVerify: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Delete("task"); err != nil {
+		t.Error("Server certificate should not be verified: ", err)
+	}
+}
+
+func TestTLSInvalid(t *testing.T) {
+	invalid := []TLS{
+		{CA: "./missing.pem"},
+		{Cert: "./cert.pem"},
+	}
+	for _, o := range invalid {
+		if _, err := NewInfluxdbWithConfig(ClientConfig{TLS: o}); err == nil {
+			t.Error("Invalid TLS options should fail: ", o)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package io
+
+import (
+	"errors"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Maximum time to wait for the response of a hook HTTP request
+const hookTimeout = 30 * time.Second
+
+// Runs a shell command. The command output is part of the error if it fails.
+func Command(cmd string) error {
+	glog.Info("DEBUG:: running command: ", cmd)
+	out, err := exec.Command("sh", "-c", cmd).CombinedOutput()
+	if err != nil {
+		return errors.New("command '" + cmd + "' failed: " + err.Error() + ":: " + string(out))
+	}
+	return nil
+}
+
+// Issues an HTTP request, failing if the response status is not 2xx
+func Request(method string, url string, body string, headers map[string]string) error {
+	glog.Info("DEBUG:: requesting ", method, " ", url)
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	c := http.Client{Timeout: hookTimeout}
+	res, err := c.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(res.Body)
+		return errors.New(method + " " + url + " failed: " + res.Status + ":: " + string(b))
+	}
+	return nil
+}
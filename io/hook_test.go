@@ -0,0 +1,50 @@
+package io
+
+import (
+	"gopkg.in/h2non/gock.v1"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	err := Command("true")
+	if err != nil {
+		t.Error("Command: Error when running a successful command:: ", err)
+	}
+
+	err = Command("echo some output && false")
+	if err == nil || !strings.Contains(err.Error(), "some output") {
+		t.Error("Command: Expected error with the command output, got ", err)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	defer gock.Off()
+	h := "http://stub:8080"
+
+	gock.New(h).
+		Put("/sideload").
+		MatchHeader("Content-Type", "application/json").
+		BodyString(`{"a": 1}`).
+		Reply(204)
+
+	err := Request("PUT", h+"/sideload", `{"a": 1}`, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		t.Error("Request: Error when issuing a valid request:: ", err)
+	}
+}
+
+func TestRequestFailed(t *testing.T) {
+	defer gock.Off()
+	h := "http://stub:8080"
+
+	gock.New(h).
+		Get("/health").
+		Reply(503).
+		BodyString("unavailable")
+
+	err := Request("GET", h+"/health", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Error("Request: Expected error with the response body, got ", err)
+	}
+}
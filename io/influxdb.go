@@ -2,7 +2,9 @@ package io
 
 import (
 	"bytes"
+	"errors"
 	"github.com/golang/glog"
+	"io/ioutil"
 	"net/http"
 )
 
@@ -19,12 +21,24 @@ func NewInfluxdb(host string) Influxdb {
 	}
 }
 
+// Creates an InfluxDB client that authenticates with the u and p query
+// parameters or a bearer token, and connects with the given TLS options
+func NewInfluxdbWithConfig(c ClientConfig) (Influxdb, error) {
+	client, err := newClient(c, true)
+	if err != nil {
+		return Influxdb{}, err
+	}
+	return Influxdb{
+		c.Host,
+		client,
+	}, nil
+}
+
 // Adds test data to influxdb
 func (influxdb Influxdb) Data(data []string, db string, rp string) error {
 	url := influxdb.Host + influxdb_write + "db=" + db + "&rp=" + rp
 	for _, d := range data {
-		_, err := influxdb.Client.Post(url, "application/x-www-form-urlencoded",
-			bytes.NewBuffer([]byte(d)))
+		err := influxdb.post(url, d)
 		if err != nil {
 			return err
 		}
@@ -40,24 +54,41 @@ func (influxdb Influxdb) Setup(db string, rp string) error {
 	if rp == "" {
 		rp = "autogen"
 	}
-	q := "q=CREATE DATABASE \""+db+"\" WITH DURATION 1h REPLICATION 1 NAME \""+rp+"\""
+	// Data is kept until the database is dropped, so that timestamped test
+	// data is not rejected for being older than the retention policy
+	q := "q=CREATE DATABASE \""+db+"\" WITH DURATION INF REPLICATION 1 NAME \""+rp+"\""
 	baseUrl := influxdb.Host + "/query"
-	_, err := influxdb.Client.Post(baseUrl, "application/x-www-form-urlencoded",
-		bytes.NewBuffer([]byte(q)))
+	err := influxdb.post(baseUrl, q)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (influxdb Influxdb) CleanUp(db string) error {
+// Drops the database of a test, with all its retention policies, as each test
+// gets its own database
+func (influxdb Influxdb) CleanUp(db string, rp string) error {
 	q := "q=DROP DATABASE \""+db+"\""
 	baseUrl := influxdb.Host + "/query"
-	_, err := influxdb.Client.Post(baseUrl, "application/x-www-form-urlencoded",
-		bytes.NewBuffer([]byte(q)))
+	err := influxdb.post(baseUrl, q)
 	if err != nil {
 		return err
 	}
 	glog.Info("DEBUG:: Influxdb cleanup database ", q)
 	return nil
 }
+
+// Posts a request to InfluxDB, failing if the response status is not 2xx
+func (influxdb Influxdb) post(url string, body string) error {
+	res, err := influxdb.Client.Post(url, "application/x-www-form-urlencoded",
+		bytes.NewBuffer([]byte(body)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		r, _ := ioutil.ReadAll(res.Body)
+		return errors.New(res.Status + ":: " + string(r))
+	}
+	return nil
+}
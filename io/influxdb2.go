@@ -0,0 +1,250 @@
+package io
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	influxdb2_orgs    = "/api/v2/orgs"
+	influxdb2_buckets = "/api/v2/buckets"
+	influxdb2_dbrps   = "/api/v2/dbrps"
+	influxdb2_write   = "/api/v2/write"
+)
+
+// InfluxDB 2.x service configurations. Test databases and retention policies
+// are mapped to buckets named <db>/<rp>, with a DBRP mapping so that
+// Kapacitor can query them with InfluxQL.
+type Influxdb2 struct {
+	Host   string
+	Org    string
+	Token  string
+	Client http.Client
+}
+
+// Creates an InfluxDB 2.x client, which authenticates with the token of the
+// client configuration
+func NewInfluxdb2WithConfig(c ClientConfig) (Influxdb2, error) {
+	if c.Org == "" || c.Auth.Token == "" {
+		return Influxdb2{}, errors.New("InfluxDB 2.x requires an organization and a token")
+	}
+	client, err := newClient(ClientConfig{TLS: c.TLS}, false)
+	if err != nil {
+		return Influxdb2{}, err
+	}
+	return Influxdb2{
+		c.Host,
+		c.Org,
+		c.Auth.Token,
+		client,
+	}, nil
+}
+
+// Returns the name of the bucket mapped to a database and retention policy
+func bucketName(db string, rp string) string {
+	// If no retention policy is defined, use "autogen"
+	if rp == "" {
+		rp = "autogen"
+	}
+	return db + "/" + rp
+}
+
+// Adds test data to the bucket of the database and retention policy
+func (influxdb Influxdb2) Data(data []string, db string, rp string) error {
+	q := url.Values{"org": {influxdb.Org}, "bucket": {bucketName(db, rp)}, "precision": {"ns"}}
+	for _, d := range data {
+		err := influxdb.request("POST", influxdb2_write+"?"+q.Encode(), "text/plain", []byte(d), nil)
+		if err != nil {
+			return err
+		}
+		glog.Info("DEBUG:: Influxdb2 added [" + d + "] to " + bucketName(db, rp))
+	}
+	return nil
+}
+
+// Creates the bucket where tests will run and maps the database and retention
+// policy to it. The bucket and mapping left by a previous run are reused.
+// Only the autogen retention policy is the default of the database.
+func (influxdb Influxdb2) Setup(db string, rp string) error {
+	glog.Info("DEBUG:: Influxdb2 setup ", bucketName(db, rp))
+	// If no retention policy is defined, use "autogen"
+	if rp == "" {
+		rp = "autogen"
+	}
+	orgId, err := influxdb.orgId()
+	if err != nil {
+		return err
+	}
+	bucketId, err := influxdb.bucketId(orgId, bucketName(db, rp))
+	if err != nil {
+		return err
+	}
+	created := false
+	if bucketId == "" {
+		var bucket struct {
+			Id string `json:"id"`
+		}
+		b := map[string]interface{}{
+			"orgID": orgId,
+			"name":  bucketName(db, rp),
+			// Data is kept until the bucket is deleted
+			"retentionRules": []interface{}{},
+		}
+		err = influxdb.post(influxdb2_buckets, b, &bucket)
+		if err != nil {
+			return err
+		}
+		bucketId, created = bucket.Id, true
+	}
+
+	mappings, err := influxdb.mappings(orgId, db, rp)
+	if err != nil {
+		return err
+	}
+	for _, m := range mappings {
+		if m.BucketId == bucketId {
+			return nil
+		}
+	}
+	m := map[string]interface{}{
+		"orgID":            orgId,
+		"bucketID":         bucketId,
+		"database":         db,
+		"retention_policy": rp,
+		"default":          rp == "autogen",
+	}
+	err = influxdb.post(influxdb2_dbrps, m, nil)
+	if err != nil && created {
+		// Does not leave behind a bucket that CleanUp cannot find
+		influxdb.request("DELETE", influxdb2_buckets+"/"+bucketId, "", nil, nil)
+	}
+	return err
+}
+
+// Deletes the DBRP mappings of a database and retention policy and the bucket
+// they map to. The other retention policies of the database are left in place,
+// as they may belong to other tests.
+func (influxdb Influxdb2) CleanUp(db string, rp string) error {
+	// If no retention policy is defined, use "autogen"
+	if rp == "" {
+		rp = "autogen"
+	}
+	orgId, err := influxdb.orgId()
+	if err != nil {
+		return err
+	}
+	mappings, err := influxdb.mappings(orgId, db, rp)
+	if err != nil {
+		return err
+	}
+	for _, m := range mappings {
+		err = influxdb.request("DELETE", influxdb2_dbrps+"/"+m.Id+"?orgID="+url.QueryEscape(orgId), "", nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	bucketId, err := influxdb.bucketId(orgId, bucketName(db, rp))
+	if err != nil {
+		return err
+	}
+	if bucketId != "" {
+		err = influxdb.request("DELETE", influxdb2_buckets+"/"+bucketId, "", nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	glog.Info("DEBUG:: Influxdb2 cleanup ", bucketName(db, rp))
+	return nil
+}
+
+// DBRP mapping of a database and retention policy to a bucket
+type dbrpMapping struct {
+	Id       string `json:"id"`
+	BucketId string `json:"bucketID"`
+}
+
+// Returns the DBRP mappings of a database and retention policy
+func (influxdb Influxdb2) mappings(orgId string, db string, rp string) ([]dbrpMapping, error) {
+	var mappings struct {
+		Content []dbrpMapping `json:"content"`
+	}
+	q := url.Values{"orgID": {orgId}, "db": {db}, "rp": {rp}}
+	err := influxdb.request("GET", influxdb2_dbrps+"?"+q.Encode(), "", nil, &mappings)
+	return mappings.Content, err
+}
+
+// Returns the id of the bucket with the given name, or an empty string if it
+// does not exist
+func (influxdb Influxdb2) bucketId(orgId string, name string) (string, error) {
+	var buckets struct {
+		Buckets []struct {
+			Id string `json:"id"`
+		} `json:"buckets"`
+	}
+	q := url.Values{"orgID": {orgId}, "name": {name}}
+	err := influxdb.request("GET", influxdb2_buckets+"?"+q.Encode(), "", nil, &buckets)
+	if err != nil || len(buckets.Buckets) == 0 {
+		return "", err
+	}
+	return buckets.Buckets[0].Id, nil
+}
+
+// Returns the id of the organization
+func (influxdb Influxdb2) orgId() (string, error) {
+	var orgs struct {
+		Orgs []struct {
+			Id string `json:"id"`
+		} `json:"orgs"`
+	}
+	err := influxdb.request("GET", influxdb2_orgs+"?org="+url.QueryEscape(influxdb.Org), "", nil, &orgs)
+	if err != nil {
+		return "", err
+	}
+	if len(orgs.Orgs) == 0 {
+		return "", errors.New("influxdb2: organization " + influxdb.Org + " not found")
+	}
+	return orgs.Orgs[0].Id, nil
+}
+
+func (influxdb Influxdb2) post(endpoint string, f map[string]interface{}, out interface{}) error {
+	j, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return influxdb.request("POST", endpoint, "application/json", j, out)
+}
+
+// Sends a request with the token, failing if the response status is not 2xx,
+// and decodes the JSON response into out, if given
+func (influxdb Influxdb2) request(method string, endpoint string, contentType string, body []byte, out interface{}) error {
+	r, err := http.NewRequest(method, influxdb.Host+endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Token "+influxdb.Token)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	res, err := influxdb.Client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(res.Status + ":: " + strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
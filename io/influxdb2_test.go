@@ -0,0 +1,205 @@
+package io
+
+import (
+	"gopkg.in/h2non/gock.v1"
+	"testing"
+)
+
+func newTestInfluxdb2(t *testing.T, h string) Influxdb2 {
+	i, err := NewInfluxdb2WithConfig(ClientConfig{Host: h, Org: "org", Auth: Auth{Token: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestInfluxdb2Setup(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Get("/api/v2/orgs").
+		MatchParam("org", "org").
+		MatchHeader("Authorization", "Token secret").
+		Reply(200).
+		JSON(`{"orgs": [{"id": "o1"}]}`)
+	gock.New(h).
+		Get("/api/v2/buckets").
+		MatchParams(map[string]string{"orgID": "o1", "name": "weather/autogen"}).
+		Reply(200).
+		JSON(`{"buckets": []}`)
+	gock.New(h).
+		Post("/api/v2/buckets").
+		MatchType("json").
+		JSON(map[string]interface{}{"orgID": "o1", "name": "weather/autogen", "retentionRules": []interface{}{}}).
+		Reply(201).
+		JSON(`{"id": "b1"}`)
+	gock.New(h).
+		Get("/api/v2/dbrps").
+		MatchParams(map[string]string{"orgID": "o1", "db": "weather", "rp": "autogen"}).
+		Reply(200).
+		JSON(`{"content": []}`)
+	gock.New(h).
+		Post("/api/v2/dbrps").
+		JSON(map[string]interface{}{"orgID": "o1", "bucketID": "b1", "database": "weather",
+			"retention_policy": "autogen", "default": true}).
+		Reply(201).
+		JSON(`{"content": {"id": "m1"}}`)
+
+	err := i.Setup("weather", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Error("Setup should create the bucket and the DBRP mapping")
+	}
+}
+
+func TestInfluxdb2SetupExisting(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Get("/api/v2/orgs").
+		Reply(200).
+		JSON(`{"orgs": [{"id": "o1"}]}`)
+	gock.New(h).
+		Get("/api/v2/buckets").
+		MatchParams(map[string]string{"orgID": "o1", "name": "weather/default"}).
+		Reply(200).
+		JSON(`{"buckets": [{"id": "b1"}]}`)
+	gock.New(h).
+		Get("/api/v2/dbrps").
+		MatchParams(map[string]string{"orgID": "o1", "db": "weather", "rp": "default"}).
+		Reply(200).
+		JSON(`{"content": [{"id": "m1", "bucketID": "b1"}]}`)
+
+	err := i.Setup("weather", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Error("Setup should look up the existing bucket and DBRP mapping")
+	}
+}
+
+func TestInfluxdb2SetupMappingFails(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Get("/api/v2/orgs").
+		Reply(200).
+		JSON(`{"orgs": [{"id": "o1"}]}`)
+	gock.New(h).
+		Get("/api/v2/buckets").
+		Reply(200).
+		JSON(`{"buckets": []}`)
+	gock.New(h).
+		Post("/api/v2/buckets").
+		Reply(201).
+		JSON(`{"id": "b1"}`)
+	gock.New(h).
+		Get("/api/v2/dbrps").
+		Reply(200).
+		JSON(`{"content": []}`)
+	gock.New(h).
+		Post("/api/v2/dbrps").
+		JSON(map[string]interface{}{"orgID": "o1", "bucketID": "b1", "database": "weather",
+			"retention_policy": "default", "default": false}).
+		Reply(422).
+		JSON(`{"code": "conflict", "message": "dbrp already exists"}`)
+	gock.New(h).
+		Delete("/api/v2/buckets/b1").
+		Reply(204)
+
+	err := i.Setup("weather", "default")
+	if err == nil {
+		t.Error("Mapping errors should be returned")
+	}
+	if !gock.IsDone() {
+		t.Error("Setup should delete the bucket it created when the mapping fails")
+	}
+}
+
+func TestInfluxdb2Data(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Post("/api/v2/write").
+		MatchParams(map[string]string{"org": "org", "bucket": "weather/default", "precision": "ns"}).
+		MatchHeader("Authorization", "Token secret").
+		BodyString("cpu value=1").
+		Reply(204)
+
+	err := i.Data([]string{"cpu value=1"}, "weather", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Error("Data should be written to the bucket of the database and retention policy")
+	}
+}
+
+func TestInfluxdb2DataError(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Post("/api/v2/write").
+		Reply(404).
+		JSON(`{"code": "not found", "message": "bucket not found"}`)
+
+	err := i.Data([]string{"cpu value=1"}, "weather", "default")
+	if err == nil {
+		t.Error("Write errors should be returned")
+	}
+}
+
+func TestInfluxdb2CleanUp(t *testing.T) {
+	defer gock.Off()
+	h := "http://influxdb:8086"
+	i := newTestInfluxdb2(t, h)
+
+	gock.New(h).
+		Get("/api/v2/orgs").
+		Reply(200).
+		JSON(`{"orgs": [{"id": "o1"}]}`)
+	gock.New(h).
+		Get("/api/v2/dbrps").
+		MatchParams(map[string]string{"orgID": "o1", "db": "weather", "rp": "default"}).
+		Reply(200).
+		JSON(`{"content": [{"id": "m1", "bucketID": "b1"}]}`)
+	gock.New(h).
+		Delete("/api/v2/dbrps/m1").
+		MatchParam("orgID", "o1").
+		Reply(204)
+	gock.New(h).
+		Get("/api/v2/buckets").
+		MatchParams(map[string]string{"orgID": "o1", "name": "weather/default"}).
+		Reply(200).
+		JSON(`{"buckets": [{"id": "b1"}]}`)
+	gock.New(h).
+		Delete("/api/v2/buckets/b1").
+		Reply(204)
+
+	err := i.CleanUp("weather", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Error("CleanUp should delete the DBRP mapping and bucket of the retention policy")
+	}
+}
+
+func TestInfluxdb2Config(t *testing.T) {
+	if _, err := NewInfluxdb2WithConfig(ClientConfig{Host: "http://influxdb:8086", Org: "org"}); err == nil {
+		t.Error("InfluxDB 2.x client should require a token")
+	}
+}
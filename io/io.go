@@ -9,4 +9,7 @@ const (
 	kapacitor_write = "/kapacitor/v1/write?"
 	influxdb_write = "/write?"
 	tasks = "/kapacitor/v1/tasks"
+	templates = "/kapacitor/v1/templates"
+	recordings = "/kapacitor/v1/recordings"
+	replays = "/kapacitor/v1/replays"
 )
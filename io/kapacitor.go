@@ -28,50 +28,121 @@ func NewKapacitor(host string) Kapacitor {
 	}
 }
 
+// Creates a Kapacitor client that authenticates with basic auth or a bearer
+// token, and connects with the given TLS options
+func NewKapacitorWithConfig(c ClientConfig) (Kapacitor, error) {
+	client, err := newClient(c, false)
+	if err != nil {
+		return Kapacitor{}, err
+	}
+	return Kapacitor{
+		c.Host,
+		client,
+	}, nil
+}
+
 // Loads a task
 func (k Kapacitor) Load(f map[string]interface{}) error {
 	glog.Info("DEBUG:: Kapacitor loading task: ", f["id"])
+	return k.create(tasks, f)
+}
+
+// Deletes a task
+func (k Kapacitor) Delete(id string) error {
+	err := k.delete(tasks, id)
+	if err != nil {
+		return err
+	}
+	glog.Info("DEBUG:: Kapacitor deleted task: ", id)
+	return nil
+}
+
+// Loads a task template
+func (k Kapacitor) LoadTemplate(f map[string]interface{}) error {
+	glog.Info("DEBUG:: Kapacitor loading template: ", f["id"])
+	return k.create(templates, f)
+}
+
+// Deletes a task template
+func (k Kapacitor) DeleteTemplate(id string) error {
+	err := k.delete(templates, id)
+	if err != nil {
+		return err
+	}
+	glog.Info("DEBUG:: Kapacitor deleted template: ", id)
+	return nil
+}
+
+// Posts a task or template definition to the given endpoint
+func (k Kapacitor) create(endpoint string, f map[string]interface{}) error {
+	j, err := EncodeTask(f)
+	if err != nil {
+		return err
+	}
+	return k.postJSON(endpoint, j)
+}
+
+// Encodes a task or template definition as the JSON body sent to Kapacitor.
+// The '.every()' of batch scripts is replaced so that queries run every second.
+func EncodeTask(f map[string]interface{}) ([]byte, error) {
 	// Replaces '.every()' if type of script is batch
 	if f["type"] == "batch" {
 		str, ok := f["script"].(string)
 		if ok != true {
-			return errors.New("Task Load: script is not of type string")
+			return nil, errors.New("Task Load: script is not of type string")
 		}
 		f["script"] = batchReplaceEvery(str)
 
 		glog.Info("DEBUG:: batch script after replace: ", f["script"])
 	}
+	return json.Marshal(f)
+}
 
+// Posts a JSON encoded body to the given endpoint
+func (k Kapacitor) post(endpoint string, f map[string]interface{}) error {
 	j, err := json.Marshal(f)
 	if err != nil {
 		return err
 	}
-	
-	u := k.Host + tasks
+	return k.postJSON(endpoint, j)
+}
+
+func (k Kapacitor) postJSON(endpoint string, j []byte) error {
+	u := k.Host + endpoint
 	res, err := k.Client.Post(u, "application/json", bytes.NewBuffer(j))
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
+	if res.StatusCode != 200 && res.StatusCode != 201 {
 		r, _ := ioutil.ReadAll(res.Body)
 		return errors.New(res.Status + ":: " + string(r))
 	}
 	return nil
 }
 
-// Deletes a task
-func (k Kapacitor) Delete(id string) error {
-	u := k.Host + tasks + "/" + id
+// Deletes the resource with the given id from the given endpoint. A resource
+// that does not exist is already deleted.
+func (k Kapacitor) delete(endpoint string, id string) error {
+	u := k.Host + endpoint + "/" + id
 	r, err := http.NewRequest("DELETE", u, nil)
 	if err != nil {
 		return err
 	}
-	_, err = k.Client.Do(r)
+	res, err := k.Client.Do(r)
 	if err != nil {
 		return err
 	}
-	glog.Info("DEBUG:: Kapacitor deleted task: ", id)
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(res.Body)
+		return errors.New(res.Status + ":: " + string(b))
+	}
 	return nil
 }
 
@@ -79,11 +150,16 @@ func (k Kapacitor) Delete(id string) error {
 func (k Kapacitor) Data(data []string, db string, rp string) error {
 	u := k.Host + kapacitor_write + "db=" + db + "&rp=" + rp
 	for _, d := range data {
-		_, err := k.Client.Post(u, "application/x-www-form-urlencoded",
+		res, err := k.Client.Post(u, "application/x-www-form-urlencoded",
 			bytes.NewBuffer([]byte(d)))
 		if err != nil {
 			return err
 		}
+		r, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return errors.New(res.Status + ":: " + string(r))
+		}
 		glog.Info("DEBUG:: Kapacitor added data: ", d)
 	}
 	return nil
@@ -92,14 +168,7 @@ func (k Kapacitor) Data(data []string, db string, rp string) error {
 // Gets task alert status
 func (k Kapacitor) Status(id string) (map[string]int, error) {
 	glog.Info("DEBUG:: Kapacitor fetching status of: ", id)
-	u := k.Host + tasks + "/" + id
-	res, err := k.Client.Get(u)
-	if err != nil {
-		return nil, err
-	}
-	var s Status
-	b, err := ioutil.ReadAll(res.Body)
-	err = json.Unmarshal(b, &s)
+	s, err := k.stats(id)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +193,54 @@ func (k Kapacitor) Status(id string) (map[string]int, error) {
 	return f, nil
 }
 
+// Gets the numeric stats of each node of a task (e.g. collected, emitted,
+// points_queried, crits_triggered)
+func (k Kapacitor) NodeStats(id string) (map[string]map[string]int, error) {
+	s, err := k.stats(id)
+	if err != nil {
+		return nil, err
+	}
+	return nodeStats(s)
+}
+
+// Returns the numeric node stats of a task or replay, by node
+func nodeStats(s Status) (map[string]map[string]int, error) {
+	f := make(map[string]map[string]int)
+	for node, value := range s.Data["node-stats"] {
+		stats, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("kapacitor.nodestats: wrong response from service")
+		}
+		f[node] = make(map[string]int)
+		for key, val := range stats {
+			if v, ok := val.(float64); ok {
+				f[node][key] = int(v)
+			}
+		}
+	}
+	return f, nil
+}
+
+// Fetches the stats of a task
+func (k Kapacitor) stats(id string) (Status, error) {
+	var s Status
+	u := k.Host + tasks + "/" + id
+	res, err := k.Client.Get(u)
+	if err != nil {
+		return s, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return s, err
+	}
+	if res.StatusCode != 200 {
+		return s, errors.New(res.Status + ":: " + string(b))
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
 // Replaces '.every(*)' for the batch request to be performed every 1s to speed up the test
 func batchReplaceEvery(s string) string {
 	re := regexp.MustCompile("every\\((.*?)\\)")
@@ -57,6 +57,56 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestLoadTemplate(t *testing.T) {
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/templates").
+		Reply(200)
+
+	f := map[string]interface{}{
+		"id":     "id",
+		"type":   "stream",
+		"script": "script",
+	}
+
+	err := k.LoadTemplate(f)
+	if err != nil {
+		t.Error("LoadTemplate: Error when passing a valid map[string]interface{}:: ", err)
+	}
+}
+
+func TestLoadTemplateError(t *testing.T) {
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/templates").
+		Reply(400).
+		BodyString("invalid TICKscript")
+
+	err := k.LoadTemplate(map[string]interface{}{"id": "id"})
+	if err == nil {
+		t.Error("LoadTemplate: Expected to return with error")
+	}
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+	tid := "template_id"
+
+	gock.New(h).
+		Delete("/kapacitor/v1/templates/" + tid).
+		Reply(204)
+
+	err := k.DeleteTemplate(tid)
+	if err != nil {
+		t.Error("DeleteTemplate: Error when deleting a valid id:: ", err)
+	}
+}
+
 func TestStatusOnAlert2(t *testing.T) {
 	h := "http://test:9093"
 	k := NewKapacitor(h)
@@ -200,3 +250,44 @@ var rain = batch
 
 }
 
+
+func TestNodeStats(t *testing.T) {
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+	tid := "task_id"
+	b := []byte(`{"stats": { "node-stats": { "stream0": { "collected": 2, "emitted": 2 }, "alert2": { "crits_triggered": 1, "collected": 2, "name": "alert2" } } }}`)
+	expected := map[string]map[string]int{
+		"stream0": {"collected": 2, "emitted": 2},
+		"alert2":  {"crits_triggered": 1, "collected": 2},
+	}
+
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/" + tid).
+		Reply(200).
+		JSON(b)
+
+	stats, err := k.NodeStats(tid)
+	if err != nil {
+		t.Error("NodeStats: Error when getting stats:: ", err)
+	}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Error("NodeStats should be ", expected, " got ", stats)
+	}
+}
+
+func TestNodeStatsTaskNotFound(t *testing.T) {
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+	tid := "task_id"
+
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/" + tid).
+		Reply(404).
+		JSON([]byte(`{"error": "no task exists"}`))
+
+	_, err := k.NodeStats(tid)
+	if err == nil {
+		t.Error("NodeStats: Expected to return with error")
+	}
+}
@@ -0,0 +1,401 @@
+// Package kapacitortest provides an in-process fake Kapacitor and InfluxDB
+// 1.x server, which implements the subset of their HTTP APIs used by
+// kapacitor-unit (tasks, templates, write, node stats, recordings, replays,
+// and the InfluxDB write and database queries). It records the requests it
+// receives and lets tests script the node stats of the tasks, so that the
+// runner can be tested offline.
+//
+// Points written to Kapacitor reach the enabled stream tasks of their
+// database and retention policy. Points written to InfluxDB are kept for the
+// batch tasks and recordings of their database and retention policy, and
+// reach the enabled stream tasks too, as with an InfluxDB subscription.
+// Replays run the task apart from the loaded task, as Kapacitor does, so the
+// replayed points only count in the node stats of the replay.
+package kapacitortest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	tasks      = "/kapacitor/v1/tasks"
+	templates  = "/kapacitor/v1/templates"
+	write      = "/kapacitor/v1/write"
+	recordings = "/kapacitor/v1/recordings"
+	replays    = "/kapacitor/v1/replays"
+
+	influxdbWrite = "/write"
+	influxdbQuery = "/query"
+)
+
+var (
+	// dbrp "db"."rp" statement of a TICKscript
+	dbrpRegexp = regexp.MustCompile(`(?m)^dbrp\s+"([^"]+)"\."([^"]+)"`)
+	// FROM "db"."rp" of a recording query
+	fromRegexp = regexp.MustCompile(`(?i)FROM\s+"([^"]+)"\."([^"]+)"`)
+	// CREATE DATABASE "db" and DROP DATABASE "db" queries
+	databaseRegexp = regexp.MustCompile(`(?i)^(CREATE|DROP) DATABASE "([^"]+)"`)
+)
+
+// Request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// Computes the node stats of a task from the points it processed, either
+// since it was loaded or in a replay
+type NodeStatsFunc func(id string, points []string) map[string]map[string]int
+
+// Fake Kapacitor and InfluxDB server
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	requests   []Request
+	tasks      map[string]map[string]interface{}
+	templates  map[string]map[string]interface{}
+	points     map[string][]string
+	stats      map[string]map[string]map[string]int
+	statsFunc  NodeStatsFunc
+	databases  map[string]bool
+	data       map[string][]string
+	recordings map[string][]string
+	replays    map[string]map[string]map[string]int
+	finished   map[string]bool
+}
+
+// Starts a fake server. Close it when the test finishes.
+func NewServer() *Server {
+	s := &Server{
+		tasks:      make(map[string]map[string]interface{}),
+		templates:  make(map[string]map[string]interface{}),
+		points:     make(map[string][]string),
+		stats:      make(map[string]map[string]map[string]int),
+		databases:  make(map[string]bool),
+		data:       make(map[string][]string),
+		recordings: make(map[string][]string),
+		replays:    make(map[string]map[string]map[string]int),
+		finished:   make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Returns the requests received by the server, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Returns the definition of a loaded task, or nil if the task does not exist
+func (s *Server) Task(id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tasks[id]
+}
+
+// Returns the ids of the loaded tasks
+func (s *Server) Tasks() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for id := range s.tasks {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Returns the definition of a loaded template, or nil if it does not exist
+func (s *Server) Template(id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.templates[id]
+}
+
+// Returns the points a task received since it was loaded
+func (s *Server) Points(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.taskPoints(id)...)
+}
+
+// Returns the names of the InfluxDB databases
+func (s *Server) Databases() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dbs := []string{}
+	for db := range s.databases {
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+
+// Sets the node stats of a task (e.g. {"alert2": {"crits_triggered": 1}})
+func (s *Server) SetNodeStats(id string, stats map[string]map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats[id] = stats
+}
+
+// Sets the function computing the node stats of the tasks without stats set
+// by SetNodeStats
+func (s *Server) SetNodeStatsFunc(f NodeStatsFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statsFunc = f
+}
+
+// Node stats of a task given the points it processed. The stream0 node of a
+// stream task collects the points, and the query1 node of a batch task
+// queries them, unless the scripted stats define them.
+func (s *Server) nodeStats(id string, points []string) map[string]map[string]int {
+	n := map[string]map[string]int{"stream0": {"collected": len(points)}}
+	if s.taskType(id) == "batch" {
+		n = map[string]map[string]int{"query1": {"points_queried": len(points)}}
+	}
+	stats, ok := s.stats[id]
+	if !ok && s.statsFunc != nil {
+		stats = s.statsFunc(id, points)
+	}
+	for node, v := range stats {
+		n[node] = v
+	}
+	return n
+}
+
+// Returns the points received by a stream task, or the points of the
+// databases queried by a batch task
+func (s *Server) taskPoints(id string) []string {
+	if s.taskType(id) != "batch" {
+		return s.points[id]
+	}
+	points := []string{}
+	for _, dbrp := range s.dbrps(id) {
+		points = append(points, s.data[dbrp]...)
+	}
+	return points
+}
+
+// Returns the type of a task, defined by its template for template tasks
+func (s *Server) taskType(id string) string {
+	t := s.tasks[id]
+	if tmpl, ok := t["template-id"].(string); ok {
+		t = s.templates[tmpl]
+	}
+	typ, _ := t["type"].(string)
+	return typ
+}
+
+// Returns the databases and retention policies of a task, either from its
+// definition or from the dbrp statements of its TICKscript, as "db"."rp"
+func (s *Server) dbrps(id string) []string {
+	t := s.tasks[id]
+	dbrps := []string{}
+	if l, ok := t["dbrps"].([]interface{}); ok {
+		for _, v := range l {
+			m, _ := v.(map[string]interface{})
+			db, _ := m["db"].(string)
+			rp, _ := m["rp"].(string)
+			dbrps = append(dbrps, dbrp(db, rp))
+		}
+	}
+	script, _ := t["script"].(string)
+	if tmpl, ok := t["template-id"].(string); ok {
+		script, _ = s.templates[tmpl]["script"].(string)
+	}
+	for _, m := range dbrpRegexp.FindAllStringSubmatch(script, -1) {
+		dbrps = append(dbrps, dbrp(m[1], m[2]))
+	}
+	return dbrps
+}
+
+// Sends points to the enabled stream tasks of a database and retention policy
+func (s *Server) stream(db string, rp string, points []string) {
+	for id, t := range s.tasks {
+		if t["status"] != "enabled" || s.taskType(id) == "batch" {
+			continue
+		}
+		for _, d := range s.dbrps(id) {
+			if d == dbrp(db, rp) {
+				s.points[id] = append(s.points[id], points...)
+				break
+			}
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{r.Method, r.URL.Path, r.URL.RawQuery, string(b)})
+
+	p := r.URL.Path
+	q := r.URL.Query()
+	switch {
+	case r.Method == "POST" && p == tasks:
+		if s.create(w, b, s.tasks) {
+			s.points[id(b)] = []string{}
+		}
+	case r.Method == "POST" && p == templates:
+		s.create(w, b, s.templates)
+	case r.Method == "POST" && p == write:
+		s.stream(q.Get("db"), q.Get("rp"), lines(b))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && p == recordings+"/query":
+		var f struct {
+			Id    string `json:"id"`
+			Query string `json:"query"`
+		}
+		json.Unmarshal(b, &f)
+		m := fromRegexp.FindStringSubmatch(f.Query)
+		if m == nil {
+			reply(w, http.StatusBadRequest, map[string]interface{}{"error": "query must select from a database and retention policy"})
+			return
+		}
+		s.recordings[f.Id] = append([]string{}, s.data[dbrp(m[1], m[2])]...)
+		s.finished[f.Id] = true
+		reply(w, http.StatusCreated, map[string]interface{}{"id": f.Id, "status": "finished"})
+	case r.Method == "POST" && p == replays:
+		var f struct {
+			Id        string `json:"id"`
+			Task      string `json:"task"`
+			Recording string `json:"recording"`
+		}
+		json.Unmarshal(b, &f)
+		if s.tasks[f.Task] == nil || !s.finished[f.Recording] {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "no task or recording exists"})
+			return
+		}
+		s.replays[f.Id] = s.nodeStats(f.Task, s.recordings[f.Recording])
+		s.finished[f.Id] = true
+		reply(w, http.StatusCreated, map[string]interface{}{"id": f.Id, "status": "finished"})
+	case r.Method == "GET" && strings.HasPrefix(p, tasks+"/"):
+		t := strings.TrimPrefix(p, tasks+"/")
+		if s.tasks[t] == nil {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "no task exists"})
+			return
+		}
+		reply(w, http.StatusOK, map[string]interface{}{
+			"id":    t,
+			"stats": map[string]interface{}{"node-stats": s.nodeStats(t, s.taskPoints(t))},
+		})
+	case r.Method == "GET" && (strings.HasPrefix(p, recordings+"/") || strings.HasPrefix(p, replays+"/")):
+		i := p[strings.LastIndex(p, "/")+1:]
+		if !s.finished[i] {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "no recording or replay exists"})
+			return
+		}
+		f := map[string]interface{}{"id": i, "status": "finished"}
+		if stats, ok := s.replays[i]; ok {
+			f["stats"] = map[string]interface{}{"node-stats": stats}
+		}
+		reply(w, http.StatusOK, f)
+	case r.Method == "DELETE" && strings.HasPrefix(p, tasks+"/"):
+		t := strings.TrimPrefix(p, tasks+"/")
+		delete(s.tasks, t)
+		delete(s.points, t)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && strings.HasPrefix(p, templates+"/"):
+		delete(s.templates, strings.TrimPrefix(p, templates+"/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && (strings.HasPrefix(p, recordings+"/") || strings.HasPrefix(p, replays+"/")):
+		i := p[strings.LastIndex(p, "/")+1:]
+		delete(s.finished, i)
+		delete(s.recordings, i)
+		delete(s.replays, i)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && p == influxdbWrite:
+		db, rp := q.Get("db"), q.Get("rp")
+		if !s.databases[db] {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "database not found: \"" + db + "\""})
+			return
+		}
+		s.data[dbrp(db, rp)] = append(s.data[dbrp(db, rp)], lines(b)...)
+		s.stream(db, rp, lines(b))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && p == influxdbQuery:
+		s.query(w, b)
+	default:
+		reply(w, http.StatusNotFound, map[string]interface{}{"error": "not found"})
+	}
+}
+
+// Runs an InfluxDB query creating or dropping a database
+func (s *Server) query(w http.ResponseWriter, b []byte) {
+	form, _ := url.ParseQuery(string(b))
+	m := databaseRegexp.FindStringSubmatch(strings.TrimSpace(form.Get("q")))
+	if m == nil {
+		reply(w, http.StatusBadRequest, map[string]interface{}{"error": "unsupported query: " + form.Get("q")})
+		return
+	}
+	if strings.ToUpper(m[1]) == "CREATE" {
+		s.databases[m[2]] = true
+	} else {
+		delete(s.databases, m[2])
+		for k := range s.data {
+			if strings.HasPrefix(k, `"`+m[2]+`".`) {
+				delete(s.data, k)
+			}
+		}
+	}
+	reply(w, http.StatusOK, map[string]interface{}{"results": []interface{}{map[string]interface{}{"statement_id": 0}}})
+}
+
+// Saves a task or template definition by id. Returns whether the definition
+// was valid.
+func (s *Server) create(w http.ResponseWriter, b []byte, defs map[string]map[string]interface{}) bool {
+	f := make(map[string]interface{})
+	if err := json.Unmarshal(b, &f); err != nil {
+		reply(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return false
+	}
+	i, _ := f["id"].(string)
+	if i == "" {
+		reply(w, http.StatusBadRequest, map[string]interface{}{"error": "must provide an id"})
+		return false
+	}
+	defs[i] = f
+	reply(w, http.StatusOK, f)
+	return true
+}
+
+// Returns the id of a JSON request body
+func id(b []byte) string {
+	var f struct {
+		Id string `json:"id"`
+	}
+	json.Unmarshal(b, &f)
+	return f.Id
+}
+
+// Returns the lines of a line protocol request body
+func lines(b []byte) []string {
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+// Returns the key of a database and retention policy. The retention policy
+// defaults to autogen, as in InfluxDB.
+func dbrp(db string, rp string) string {
+	if rp == "" {
+		rp = "autogen"
+	}
+	return `"` + db + `"."` + rp + `"`
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
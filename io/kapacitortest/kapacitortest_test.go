@@ -0,0 +1,170 @@
+package kapacitortest
+
+import (
+	"github.com/gpestana/kapacitor-unit/io"
+	"reflect"
+	"testing"
+)
+
+func TestServerTasks(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+
+	err := k.Load(map[string]interface{}{"id": "task", "type": "stream", "script": "stream", "status": "enabled",
+		"dbrps": []map[string]string{{"db": "db", "rp": "rp"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Task("task")["script"] != "stream" {
+		t.Error("Task should be loaded: ", s.Task("task"))
+	}
+	err = k.Data([]string{"cpu value=1", "cpu value=2"}, "db", "rp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := k.NodeStats("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["stream0"]["collected"] != 2 {
+		t.Error("Task should collect the written points: ", stats)
+	}
+	err = k.Delete("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.NodeStats("task"); err == nil {
+		t.Error("Deleted task should not exist")
+	}
+
+	r := s.Requests()
+	if len(r) != 6 || r[1].Path != "/kapacitor/v1/write" || r[1].Query != "db=db&rp=rp" || r[1].Body != "cpu value=1" {
+		t.Error("Unexpected requests: ", r)
+	}
+}
+
+func TestServerNodeStats(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+
+	s.SetNodeStats("a", map[string]map[string]int{"alert2": {"crits_triggered": 1}})
+	s.SetNodeStatsFunc(func(id string, points []string) map[string]map[string]int {
+		return map[string]map[string]int{"alert3": {"warns_triggered": len(points)}}
+	})
+	k.Load(map[string]interface{}{"id": "a", "type": "stream", "script": "dbrp \"db\".\"rp\"\nstream", "status": "enabled"})
+	k.Load(map[string]interface{}{"id": "b", "type": "stream", "script": "dbrp \"db\".\"rp\"\nstream", "status": "enabled"})
+	k.Data([]string{"cpu value=1"}, "db", "rp")
+
+	status, err := k.Status("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status, map[string]int{"crits_triggered": 1}) {
+		t.Error("Scripted node stats not returned: ", status)
+	}
+	status, err = k.Status("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status, map[string]int{"warns_triggered": 1}) {
+		t.Error("Node stats function not applied: ", status)
+	}
+}
+
+func TestServerWriteRouting(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+
+	k.Load(map[string]interface{}{"id": "a", "type": "stream", "script": "stream", "status": "enabled",
+		"dbrps": []map[string]string{{"db": "db_ku1", "rp": "autogen"}}})
+	k.Load(map[string]interface{}{"id": "b", "type": "stream", "script": "dbrp \"db_ku2\".\"autogen\"\nstream",
+		"status": "enabled"})
+	k.Load(map[string]interface{}{"id": "c", "type": "stream", "script": "stream", "status": "disabled",
+		"dbrps": []map[string]string{{"db": "db_ku1", "rp": "autogen"}}})
+	k.Data([]string{"cpu value=1"}, "db_ku1", "")
+	k.Data([]string{"cpu value=2", "cpu value=3"}, "db_ku2", "autogen")
+
+	if len(s.Points("a")) != 1 || len(s.Points("b")) != 2 {
+		t.Error("Tasks should only receive the points of their database: ", s.Points("a"), s.Points("b"))
+	}
+	if len(s.Points("c")) != 0 {
+		t.Error("Disabled tasks should not receive points: ", s.Points("c"))
+	}
+}
+
+func TestServerInfluxdb(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	if err := i.Data([]string{"cpu value=1"}, "db", "rp"); err == nil {
+		t.Error("Writing to a missing database should fail")
+	}
+	if err := i.Setup("db", "rp"); err != nil {
+		t.Fatal(err)
+	}
+	k.Load(map[string]interface{}{"id": "batch", "type": "batch", "script": "batch", "status": "enabled",
+		"dbrps": []map[string]string{{"db": "db", "rp": "rp"}}})
+	k.Load(map[string]interface{}{"id": "stream", "type": "stream", "script": "stream", "status": "enabled",
+		"dbrps": []map[string]string{{"db": "db", "rp": "rp"}}})
+	if err := i.Data([]string{"cpu value=1", "cpu value=2"}, "db", "rp"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := k.NodeStats("batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["query1"]["points_queried"] != 2 {
+		t.Error("Batch task should query the points of its database: ", stats)
+	}
+	if len(s.Points("stream")) != 2 {
+		t.Error("Stream task should receive the points written to InfluxDB: ", s.Points("stream"))
+	}
+
+	if err := i.CleanUp("db", "rp"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Databases()) != 0 || len(s.Points("batch")) != 0 {
+		t.Error("Database should be dropped with its data: ", s.Databases())
+	}
+}
+
+func TestServerReplay(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	i.Setup("db", "")
+	i.Data([]string{"cpu value=1 1000000000", "cpu value=2 2000000000"}, "db", "")
+	k.Load(map[string]interface{}{"id": "task", "type": "stream", "script": "stream", "status": "disabled",
+		"dbrps": []map[string]string{{"db": "db", "rp": "autogen"}}})
+
+	if err := k.RecordQuery("rec", "stream", `SELECT * FROM "db"."autogen"./.*/`); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Replay("rep", "task", "rec", "fast"); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := k.ReplayStats("rep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["stream0"]["collected"] != 2 {
+		t.Error("Replay should process the recorded points: ", stats)
+	}
+	if len(s.Points("task")) != 0 {
+		t.Error("Replayed points should not reach the loaded task: ", s.Points("task"))
+	}
+	if err := k.DeleteReplay("rep"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DeleteRecording("rec"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+package io
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"time"
+)
+
+// Interval between requests when waiting for a recording or replay to finish
+const pollInterval = 100 * time.Millisecond
+
+// Maximum time to wait for a recording or replay to finish
+const replayTimeout = time.Minute
+
+// Creates a recording of the given type (stream or batch) with the result of
+// an InfluxDB query, and waits for it to finish
+func (k Kapacitor) RecordQuery(id string, typ string, query string) error {
+	glog.Info("DEBUG:: Kapacitor recording query: ", query)
+	f := map[string]interface{}{
+		"id":    id,
+		"type":  typ,
+		"query": query,
+	}
+	err := k.post(recordings+"/query", f)
+	if err != nil {
+		return err
+	}
+	return k.waitFinished(recordings, id)
+}
+
+// Deletes a recording
+func (k Kapacitor) DeleteRecording(id string) error {
+	err := k.delete(recordings, id)
+	if err != nil {
+		return err
+	}
+	glog.Info("DEBUG:: Kapacitor deleted recording: ", id)
+	return nil
+}
+
+// Replays a recording against a task using the given clock (fast or real),
+// and waits for the replay to finish. Data points keep the recording time.
+func (k Kapacitor) Replay(id string, task string, recording string, clock string) error {
+	glog.Info("DEBUG:: Kapacitor replaying recording ", recording, " against task ", task)
+	f := map[string]interface{}{
+		"id":             id,
+		"task":           task,
+		"recording":      recording,
+		"clock":          clock,
+		"recording-time": true,
+	}
+	err := k.post(replays, f)
+	if err != nil {
+		return err
+	}
+	return k.waitFinished(replays, id)
+}
+
+// Returns the node stats of a finished replay. Replays run the task
+// separately from the task loaded in Kapacitor, whose stats do not include
+// the replayed data.
+func (k Kapacitor) ReplayStats(id string) (map[string]map[string]int, error) {
+	var s Status
+	res, err := k.Client.Get(k.Host + replays + "/" + id)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, errors.New(res.Status + ":: " + string(b))
+	}
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return nil, err
+	}
+	return nodeStats(s)
+}
+
+// Deletes a replay
+func (k Kapacitor) DeleteReplay(id string) error {
+	err := k.delete(replays, id)
+	if err != nil {
+		return err
+	}
+	glog.Info("DEBUG:: Kapacitor deleted replay: ", id)
+	return nil
+}
+
+// Polls a recording or replay until its status is not running anymore
+func (k Kapacitor) waitFinished(endpoint string, id string) error {
+	var s struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	deadline := time.Now().Add(replayTimeout)
+	for {
+		res, err := k.Client.Get(k.Host + endpoint + "/" + id)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(b, &s)
+		if err != nil {
+			return err
+		}
+		switch s.Status {
+		case "finished":
+			return nil
+		case "failed":
+			return errors.New("kapacitor: " + id + " failed: " + s.Error)
+		}
+		if time.Now().After(deadline) {
+			return errors.New("kapacitor: timed out waiting for " + id + " to finish")
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,121 @@
+package io
+
+import (
+	"gopkg.in/h2non/gock.v1"
+	"strings"
+	"testing"
+)
+
+func TestRecordQuery(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/recordings/query").
+		Reply(201).
+		JSON(map[string]string{"id": "rec", "status": "running"})
+	gock.New(h).
+		Get("/kapacitor/v1/recordings/rec").
+		Reply(200).
+		JSON(map[string]string{"id": "rec", "status": "running"})
+	gock.New(h).
+		Get("/kapacitor/v1/recordings/rec").
+		Reply(200).
+		JSON(map[string]string{"id": "rec", "status": "finished"})
+
+	err := k.RecordQuery("rec", "stream", "SELECT * FROM db.rp./.*/")
+	if err != nil {
+		t.Error("RecordQuery: Error when recording a valid query:: ", err)
+	}
+	if !gock.IsDone() {
+		t.Error("RecordQuery: should wait for recording to finish")
+	}
+}
+
+func TestRecordQueryFailed(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/recordings/query").
+		Reply(201).
+		JSON(map[string]string{"id": "rec", "status": "running"})
+	gock.New(h).
+		Get("/kapacitor/v1/recordings/rec").
+		Reply(200).
+		JSON(map[string]string{"id": "rec", "status": "failed", "error": "bad query"})
+
+	err := k.RecordQuery("rec", "stream", "SELECT")
+	if err == nil || !strings.Contains(err.Error(), "bad query") {
+		t.Error("RecordQuery: expected recording failure error, got ", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/replays").
+		JSON(map[string]interface{}{
+			"id":             "replay",
+			"task":           "task",
+			"recording":      "rec",
+			"clock":          "fast",
+			"recording-time": true,
+		}).
+		Reply(201).
+		JSON(map[string]string{"id": "replay", "status": "running"})
+	gock.New(h).
+		Get("/kapacitor/v1/replays/replay").
+		Reply(200).
+		JSON(map[string]string{"id": "replay", "status": "finished"})
+
+	err := k.Replay("replay", "task", "rec", "fast")
+	if err != nil {
+		t.Error("Replay: Error when replaying a valid recording:: ", err)
+	}
+}
+
+func TestReplayStats(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Get("/kapacitor/v1/replays/replay").
+		Reply(200).
+		JSON(`{"id": "replay", "status": "finished", "stats": {"task-stats": {"throughput": 0},
+			"node-stats": {"stream0": {"collected": 3}, "alert2": {"crits_triggered": 1, "errors": 0}}}}`)
+
+	s, err := k.ReplayStats("replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s["stream0"]["collected"] != 3 || s["alert2"]["crits_triggered"] != 1 {
+		t.Error("ReplayStats: unexpected node stats: ", s)
+	}
+}
+
+func TestDeleteRecordingAndReplay(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := NewKapacitor(h)
+
+	gock.New(h).
+		Delete("/kapacitor/v1/recordings/rec").
+		Reply(204)
+	gock.New(h).
+		Delete("/kapacitor/v1/replays/replay").
+		Reply(204)
+
+	if err := k.DeleteRecording("rec"); err != nil {
+		t.Error("DeleteRecording: Error when deleting a valid id:: ", err)
+	}
+	if err := k.DeleteReplay("replay"); err != nil {
+		t.Error("DeleteReplay: Error when deleting a valid id:: ", err)
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/gpestana/kapacitor-unit/cli"
 	"github.com/gpestana/kapacitor-unit/io"
 	"github.com/gpestana/kapacitor-unit/task"
@@ -10,66 +10,169 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 type TestCollection []test.Test
 
 func main() {
-	fmt.Println(renderWelcome())
-
 	f := cli.Load()
-	kapacitor := io.NewKapacitor(f.KapacitorHost)
-	influxdb := io.NewInfluxdb(f.InfluxdbHost)
+	test.DefaultTimeout = f.Timeout
 
-	tests, err := testConfig(f.TestsPath)
-	if err != nil {
-		log.Fatal("Error loading test configurations: ", err)
+	// Keeps the output of list and dry runs free to be piped to other tools
+	if f.Command != cli.List && !f.DryRun {
+		fmt.Println(renderWelcome())
 	}
-	err = initTests(tests, f.ScriptsDir)
-	if err != nil {
-		log.Fatal("Init Tests failed: ", err)
+
+	// The seed of a dry run goes to stderr, apart from the task definitions
+	if f.Shuffle && f.DryRun {
+		fmt.Fprintf(os.Stderr, "Tests in random order, seed %d (--seed %d to reproduce)\n", f.Seed, f.Seed)
+	} else if f.Shuffle && f.Command != cli.List {
+		fmt.Printf("Running tests in random order, seed %d (--seed %d to reproduce)\n\n", f.Seed, f.Seed)
 	}
 
-	// Validates, runs tests in series and print results
-	for _, t := range tests {
-		if err := t.Validate(); err != nil {
-			log.Println(err)
-			continue
+	if f.Command == cli.List {
+		tests, err := testConfig(f.TestsPath)
+		if err != nil {
+			log.Fatal("Error loading test configurations: ", err)
 		}
-		// Runs the test only if there was no errors during constructor and validation
-		if t.Result.Error == true {
-			log.Println(t.Result.Message)
-			continue
+		tests, err = selectTests(tests, f)
+		if err != nil {
+			log.Fatal(err)
 		}
-		// Runs test
-		err = t.Run(kapacitor, influxdb)
+		listTests(os.Stdout, tests)
+		return
+	}
+
+	if f.DryRun {
+		tests, err := loadTests(f)
 		if err != nil {
-			log.Println("Error running test: ", t, " Error: ", err)
-			continue
+			log.Fatal(err)
+		}
+		if !dryRun(os.Stdout, tests) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	kapacitor, err := io.NewKapacitorWithConfig(f.Kapacitor)
+	if err != nil {
+		log.Fatal("ERROR: Kapacitor client: ", err)
+	}
+	influxdb, err := newInfluxdb(f)
+	if err != nil {
+		log.Fatal("ERROR: InfluxDB client: ", err)
+	}
+
+	// Stops starting new tests if the run is interrupted. The running tests
+	// finish and tear down, and the after_all hooks run, before exiting. A
+	// second interrupt exits right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Println("Interrupted, waiting for the running tests to tear down")
+		cancel()
+		<-interrupt
+		os.Exit(130)
+	}()
+
+	if f.Watch {
+		watch(ctx, f, kapacitor, influxdb)
+		os.Exit(130)
+	}
+
+	tests, err := loadTests(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, hooksOk := runSuite(ctx, tests, kapacitor, influxdb, f)
+	fmt.Println()
+	fmt.Println(s)
+	fmt.Println()
+	ok := s.Ok() && hooksOk
+	if f.Count > 1 {
+		fmt.Println(flakyReport(tests, f.Count))
+	}
+	if f.Report != "" {
+		if err := writeReport(f.Report, tests); err != nil {
+			log.Println("Error writing report: ", err)
 		}
-		//Prints test output
-		setColor(t)
-		log.Println(t)
-		color.Unset()
+	}
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
+	if !ok {
+		os.Exit(1)
 	}
 }
 
-// Sets output color based on test results
-func setColor(t test.Test) {
-	if t.Result.Passed == true {
-		color.Set(color.FgGreen)
-	} else {
-		color.Set(color.FgRed)
+// Creates the client of the InfluxDB API version
+func newInfluxdb(f *cli.Config) (io.DataBackend, error) {
+	if f.Influxdb.Version == 2 {
+		return io.NewInfluxdb2WithConfig(f.Influxdb)
+	}
+	return io.NewInfluxdbWithConfig(f.Influxdb)
+}
+
+// Loads and selects the tests, reads their TICKscripts and gives each test a
+// unique task id
+func loadTests(f *cli.Config) (TestCollection, error) {
+	tests, err := testConfig(f.TestsPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading test configurations: %v", err)
+	}
+	tests, err = selectTests(tests, f)
+	if err != nil {
+		return nil, err
 	}
+	if f.Shuffle {
+		shuffleTests(tests, f.Seed)
+	}
+	err = initTests(tests, f.ScriptsDir)
+	if err != nil {
+		return nil, fmt.Errorf("Init Tests failed: %v", err)
+	}
+
+	// Gives each test a unique task id and isolates tests from each other
+	// and from other runs
+	runId := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for i := range tests {
+		tests[i].Id = taskId(f.TaskPrefix, runId, i)
+		tests[i].KeepArtifacts = f.KeepArtifacts
+		tests[i].Isolate(namespace(runId, i))
+	}
+	return tests, nil
+}
+
+// Returns the id of the Kapacitor task of a test, unique to the test run
+func taskId(prefix string, runId string, i int) string {
+	return fmt.Sprintf("%v-%v-%d", prefix, runId, i)
+}
+
+// Returns the suffix of the databases of a test, unique to the test run
+func namespace(runId string, i int) string {
+	return fmt.Sprintf("ku%v_%d", runId, i)
 }
 
 func loadYamlFile(fileName string) (TestCollection, error) {
 
+	// Tests are first decoded generically so that the loader can expand them
+	// (e.g. parameters and fixtures references) before decoding them into
+	// test.Test
 	type conf struct {
-		Tests TestCollection
+		Fixtures map[string][]string
+		Tests    []map[string]interface{}
+		Hooks    test.Hooks `yaml:",inline"`
 	}
 
 	b, err := ioutil.ReadFile(fileName)
@@ -85,8 +188,98 @@ func loadYamlFile(fileName string) (TestCollection, error) {
 		return nil, err
 	}
 
-	return c.Tests, err
+	expanded := []map[string]interface{}{}
+	for _, t := range c.Tests {
+		e, err := expandParams(t)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", fileName, err)
+		}
+		expanded = append(expanded, e...)
+	}
+	c.Tests = expanded
+
+	for _, t := range c.Tests {
+		err = expandFixtures(t, c.Fixtures)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", fileName, err)
+		}
+	}
+
+	tests := TestCollection{}
+	b, err = yaml.Marshal(c.Tests)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(b, &tests)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tests {
+		tests[i].ExpandTasks()
+		tests[i].File = fileName
+		tests[i].Hooks = &c.Hooks
+	}
+	return tests, nil
+
+}
+
+// Replaces the fixture references in the test data and in the data of the
+// test steps (e.g. {fixture: baseline}) by the data points of the referenced
+// fixture. Nested lists, such as YAML aliases of anchored data (e.g.
+// [*baseline, "cpu value=99"]), are flattened.
+func expandFixtures(t map[string]interface{}, fixtures map[string][]string) error {
+	if d, ok := t["data"].([]interface{}); ok {
+		data, err := expandData(d, fixtures)
+		if err != nil {
+			return fmt.Errorf("test %v: %v", t["name"], err)
+		}
+		t["data"] = data
+	}
+	steps, _ := t["steps"].([]interface{})
+	for j, s := range steps {
+		step, ok := s.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if d, ok := step["data"].([]interface{}); ok {
+			data, err := expandData(d, fixtures)
+			if err != nil {
+				return fmt.Errorf("test %v: step %d: %v", t["name"], j+1, err)
+			}
+			step["data"] = data
+		}
+	}
+	return nil
+}
 
+func expandData(d []interface{}, fixtures map[string][]string) ([]interface{}, error) {
+	data := make([]interface{}, 0, len(d))
+	for _, p := range d {
+		switch e := p.(type) {
+		case []interface{}:
+			l, err := expandData(e, fixtures)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, l...)
+		case map[interface{}]interface{}:
+			name, ok := e["fixture"].(string)
+			if !ok {
+				return nil, fmt.Errorf("data entry %v is neither line protocol nor a fixture reference", e)
+			}
+			f, ok := fixtures[name]
+			if !ok {
+				return nil, fmt.Errorf("fixture %v is not defined", name)
+			}
+			for _, l := range f {
+				data = append(data, l)
+			}
+		default:
+			data = append(data, p)
+		}
+	}
+	return data, nil
 }
 
 //Opens and parses test configuration file into a structure
@@ -124,14 +317,62 @@ func testConfig(fileName string) (TestCollection, error) {
 	return tests, nil
 }
 
+// Selects the tests with a name matching the expression and with any of the
+// tags, if defined, and without any of the excluded tags
+func filterTests(c TestCollection, run *regexp.Regexp, tags []string, exclude []string) TestCollection {
+	tests := make(TestCollection, 0, len(c))
+	for _, t := range c {
+		if run != nil && !run.MatchString(t.Name) {
+			continue
+		}
+		if len(tags) > 0 && !t.HasTag(tags...) {
+			continue
+		}
+		if t.HasTag(exclude...) {
+			continue
+		}
+		tests = append(tests, t)
+	}
+	return tests
+}
+
+// Selects the tests matching the filters and belonging to the shard
+func selectTests(c TestCollection, f *cli.Config) (TestCollection, error) {
+	tests := filterTests(c, f.Run, f.Tags, f.ExcludeTags)
+	var timings map[string]time.Duration
+	if f.Timings != "" {
+		var err error
+		timings, err = readTimings(f.Timings)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading timings report: %v", err)
+		}
+	}
+	return shardTests(tests, f.Shard, f.Shards, timings), nil
+}
+
+// Shuffles the tests in a random order given by the seed
+func shuffleTests(c TestCollection, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(c), func(i, j int) {
+		c[i], c[j] = c[j], c[i]
+	})
+}
+
 //Populates each of Test in Configuration struct with an initialized Task
 func initTests(c TestCollection, p string) error {
 	for i, t := range c {
-		tk, err := task.New(t.TaskName, p)
+		tk, err := task.New(t.ScriptName(), p)
 		if err != nil {
 			return err
 		}
 		c[i].Task = *tk
+		for j := 1; j < len(t.Tasks); j++ {
+			tk, err := task.New(t.Tasks[j].ScriptName(), p)
+			if err != nil {
+				return err
+			}
+			c[i].Tasks[j].Task = *tk
+		}
 	}
 	return nil
 }
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"github.com/gpestana/kapacitor-unit/cli"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/test"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -129,3 +137,329 @@ tests:
 		t.Error(tests[0].Task.Name)
 	}
 }
+
+func TestInitTestsTemplate(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: "alert weather template"
+   template_name: alert_weather_template.tick
+   vars:
+     warn:
+       type: int
+       value: 60
+   db: weather
+   rp: default
+   data:
+    - data 1
+`
+
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = initTests(tests, "./sample/tick_scripts")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if tests[0].Task.Name != "alert_weather_template.tick" {
+		t.Error(tests[0].Task.Name)
+	}
+	if tests[0].Vars["warn"].Type != "int" || tests[0].Vars["warn"].Value != 60 {
+		t.Error("Vars not parsed as expected: ", tests[0].Vars)
+	}
+}
+
+func TestConfigFixtures(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+fixtures:
+  baseline: &baseline
+    - cpu value=10
+    - cpu value=20
+
+tests:
+ - name: test1
+   task_name: "test 1"
+   data:
+    - fixture: baseline
+    - cpu value=99
+
+ - name: test2
+   task_name: "test 2"
+   data:
+    - cpu value=1
+    - {fixture: baseline}
+
+ - name: test3
+   task_name: "test 3"
+   data: [*baseline, "cpu value=99"]
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp1 := []string{"cpu value=10", "cpu value=20", "cpu value=99"}
+	if !reflect.DeepEqual(tests[0].Data, exp1) {
+		t.Error("Fixture not expanded as expected: ", tests[0].Data)
+	}
+	exp2 := []string{"cpu value=1", "cpu value=10", "cpu value=20"}
+	if !reflect.DeepEqual(tests[1].Data, exp2) {
+		t.Error("Fixture not expanded as expected: ", tests[1].Data)
+	}
+	if !reflect.DeepEqual(tests[2].Data, exp1) {
+		t.Error("Anchored data not expanded as expected: ", tests[2].Data)
+	}
+}
+
+func TestConfigTasks(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: test1
+   task_names: [derive.tick, alert.tick]
+
+ - name: test2
+   tasks:
+    - task_name: derive.tick
+    - template_name: alert_template.tick
+      vars:
+        crit: {type: float, value: 80}
+      expects:
+        crit: 1
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tests[0].TaskName != "derive.tick" || len(tests[0].Tasks) != 2 || tests[0].Tasks[1].TaskName != "alert.tick" {
+		t.Error("Task names not loaded as expected: ", tests[0].TaskName, tests[0].Tasks)
+	}
+	a := tests[1].Tasks[1]
+	if a.TemplateName != "alert_template.tick" || a.Vars["crit"].Value != 80 || a.Expects == nil || a.Expects.Crit != 1 {
+		t.Error("Tasks not loaded as expected: ", tests[1].Tasks)
+	}
+}
+
+func TestConfigStepsFixtures(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+fixtures:
+  baseline:
+    - cpu value=10
+
+tests:
+ - name: test1
+   task_name: "test 1"
+   steps:
+    - name: normal
+      data:
+       - fixture: baseline
+    - name: spike
+      data: ["cpu value=99"]
+      expects:
+        crit: 1
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := tests[0].Steps
+	if len(s) != 2 || !reflect.DeepEqual(s[0].Data, []string{"cpu value=10"}) || s[1].Expects.Crit != 1 {
+		t.Error("Steps not loaded as expected: ", s)
+	}
+}
+
+func TestConfigUnknownFixture(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: test1
+   task_name: "test 1"
+   data:
+    - fixture: baseline
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	_, err := testConfig(p)
+	if err == nil {
+		t.Error("Reference to undefined fixture should return error")
+	}
+}
+
+func TestTaskId(t *testing.T) {
+	id := taskId("kapacitor-unit", "jc2x1a9", 3)
+	if id != "kapacitor-unit-jc2x1a9-3" {
+		t.Error("Task id should be kapacitor-unit-jc2x1a9-3, got ", id)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	ns := namespace("jc2x1a9", 3)
+	if ns != "kujc2x1a9_3" {
+		t.Error("Namespace should be kujc2x1a9_3, got ", ns)
+	}
+}
+
+func TestLoadTestsRecording(t *testing.T) {
+	d, err := ioutil.TempDir("", "kapacitor-unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	createConfFile(filepath.Join(d, "alert.tick"), "dbrp \"weather\".\"autogen\"\n\nstream")
+	c := `
+tests:
+ - name: "recorded"
+   task_name: alert.tick
+   db: weather
+   rp: autogen
+   recording_id: rec-1
+ - name: "written"
+   task_name: alert.tick
+   db: weather
+   rp: autogen
+   data:
+    - cpu value=1
+`
+	createConfFile(filepath.Join(d, "tests.yaml"), c)
+
+	tests, err := loadTests(&cli.Config{TestsPath: filepath.Join(d, "tests.yaml"), ScriptsDir: d, TaskPrefix: "kapacitor-unit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tests[0].Db != "weather" || !strings.HasPrefix(tests[0].Task.Script, "dbrp \"weather\".\"autogen\"") {
+		t.Error("Recording test should keep the database of the recording: ", tests[0].Db, tests[0].Task.Script)
+	}
+	if tests[1].Db == "weather" || strings.HasPrefix(tests[1].Task.Script, "dbrp \"weather\".\"autogen\"") {
+		t.Error("Test writing its data should be isolated: ", tests[1].Db, tests[1].Task.Script)
+	}
+}
+
+func TestFilterTests(t *testing.T) {
+	tests := TestCollection{
+		{Name: "Alert weather:: warning", Tags: []string{"weather", "slow"}},
+		{Name: "Alert weather:: critical", Tags: []string{"weather"}},
+		{Name: "Alert cpu:: critical", Tags: []string{"cpu"}},
+		{Name: "Alert disk:: critical"},
+	}
+	names := func(c TestCollection) []string {
+		n := []string{}
+		for _, t := range c {
+			n = append(n, t.Name)
+		}
+		return n
+	}
+
+	r := filterTests(tests, regexp.MustCompile("critical"), nil, nil)
+	exp := []string{"Alert weather:: critical", "Alert cpu:: critical", "Alert disk:: critical"}
+	if !reflect.DeepEqual(names(r), exp) {
+		t.Error("Tests filtered by name should be ", exp, " got ", names(r))
+	}
+
+	r = filterTests(tests, nil, []string{"weather", "cpu"}, []string{"slow"})
+	exp = []string{"Alert weather:: critical", "Alert cpu:: critical"}
+	if !reflect.DeepEqual(names(r), exp) {
+		t.Error("Tests filtered by tags should be ", exp, " got ", names(r))
+	}
+
+	r = filterTests(tests, regexp.MustCompile(""), nil, nil)
+	if len(r) != len(tests) {
+		t.Error("Empty expression should select all tests, got ", names(r))
+	}
+}
+
+func TestConfigHooks(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+before_all:
+  - command: echo before all
+after_each:
+  - http:
+      method: DELETE
+      url: http://stub:8080/state
+
+tests:
+ - name: test1
+   task_name: "test 1"
+ - name: test2
+   task_name: "test 2"
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tests[0].File != p || tests[0].Hooks != tests[1].Hooks {
+		t.Fatal("Tests should share the hooks of their file")
+	}
+	h := tests[0].Hooks
+	if len(h.BeforeAll) != 1 || h.BeforeAll[0].Command != "echo before all" {
+		t.Error("before_all hook not parsed as expected: ", h.BeforeAll)
+	}
+	if len(h.AfterEach) != 1 || h.AfterEach[0].Http.Method != "DELETE" {
+		t.Error("after_each hook not parsed as expected: ", h.AfterEach)
+	}
+	if len(fileHooks(tests)) != 1 {
+		t.Error("Tests of the same file should have one set of hooks")
+	}
+}
+
+func TestShuffleTests(t *testing.T) {
+	names := func(c TestCollection) []string {
+		n := []string{}
+		for _, tst := range c {
+			n = append(n, tst.Name)
+		}
+		return n
+	}
+	c := TestCollection{}
+	for _, n := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		c = append(c, test.Test{Name: n})
+	}
+	c1 := append(TestCollection{}, c...)
+	c2 := append(TestCollection{}, c...)
+	shuffleTests(c1, 42)
+	shuffleTests(c2, 42)
+	if !reflect.DeepEqual(names(c1), names(c2)) {
+		t.Error("The same seed should give the same order: ", names(c1), names(c2))
+	}
+	if reflect.DeepEqual(names(c1), names(c)) {
+		t.Error("Tests should be shuffled: ", names(c1))
+	}
+}
+
+func TestNewInfluxdb(t *testing.T) {
+	f := &cli.Config{Influxdb: io.ClientConfig{Host: "http://influxdb:8086", Version: 2, Org: "org", Auth: io.Auth{Token: "secret"}}}
+	i, err := newInfluxdb(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.(io.Influxdb2); !ok {
+		t.Error("InfluxDB version 2 should use the InfluxDB 2.x client, got ", i)
+	}
+	f.Influxdb.Version = 1
+	i, err = newInfluxdb(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.(io.Influxdb); !ok {
+		t.Error("InfluxDB version 1 should use the InfluxDB 1.x client, got ", i)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Prints the file, name, task, type and tags of each test
+func listTests(w io.Writer, tests TestCollection) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tNAME\tTASK\tTYPE\tTAGS")
+	for _, t := range tests {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n",
+			t.File, t.Name, strings.Join(t.ScriptNames(), ","), t.Type, strings.Join(t.Tags, ","))
+	}
+	tw.Flush()
+}
+
+// Validates the tests and prints the template and task definitions each test
+// would send to Kapacitor. Returns whether all tests are valid.
+func dryRun(w io.Writer, tests TestCollection) bool {
+	ok := true
+	for i := range tests {
+		t := &tests[i]
+		fmt.Fprintf(w, "%v (%v):\n", t.Name, t.File)
+		t.Validate()
+		if t.Result.Error {
+			fmt.Fprintln(w, "  ERROR:", t.Result.Message)
+			ok = false
+			continue
+		}
+		defs, err := t.DryRun()
+		if err != nil {
+			fmt.Fprintln(w, "  ERROR:", err)
+			ok = false
+			continue
+		}
+		for _, d := range defs {
+			fmt.Fprintln(w, "  "+d)
+		}
+	}
+	return ok
+}
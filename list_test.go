@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"github.com/gpestana/kapacitor-unit/task"
+	"strings"
+	"testing"
+)
+
+func TestListTests(t *testing.T) {
+	tests := TestCollection{
+		{Name: "alert", File: "t.yaml", TaskName: "alert.tick", Type: "stream", Tags: []string{"smoke", "cpu"}},
+		{Name: "batch alert", File: "t.yaml", TemplateName: "batch.tick", Type: "batch"},
+	}
+	var b bytes.Buffer
+	listTests(&b, tests)
+	l := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(l) != 3 {
+		t.Fatal("List should have a header and a line per test, got ", b.String())
+	}
+	if strings.Join(strings.Fields(l[1]), " ") != "t.yaml alert alert.tick stream smoke,cpu" {
+		t.Error("Unexpected test line: ", l[1])
+	}
+	if strings.Join(strings.Fields(l[2]), " ") != "t.yaml batch alert batch.tick batch" {
+		t.Error("Unexpected test line: ", l[2])
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tests := TestCollection{
+		{Name: "valid", TaskName: "alert.tick", Type: "stream", Db: "weather", Rp: "default",
+			Task: task.Task{Script: "stream"}},
+		{Name: "invalid", TaskName: "alert.tick", TemplateName: "alert.tick", Type: "stream"},
+	}
+	var b bytes.Buffer
+	if dryRun(&b, tests) {
+		t.Error("Dry run should fail with an invalid test")
+	}
+	if !strings.Contains(b.String(), `"script":"stream"`) {
+		t.Error("Dry run should print the task of the valid test, got ", b.String())
+	}
+	if !strings.Contains(b.String(), "invalid ():\n  ERROR:") {
+		t.Error("Dry run should print the error of the invalid test, got ", b.String())
+	}
+	if tests[1].Result.Error != true {
+		t.Error("Invalid test should have an error result")
+	}
+}
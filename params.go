@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Scalar that is exactly a parameter reference (e.g. "{{.value}}"), replaced
+// by the parameter value keeping its type
+var paramRegexp = regexp.MustCompile(`^\{\{\s*\.(\w+)\s*\}\}$`)
+
+// Expands a parametrized test into a test per combination of the values of
+// its matrix, or per case of its cases. Parameters are referenced as
+// {{.name}} in any field of the test, and each test name is suffixed with its
+// parameters (e.g. "Alert weather [value=82]"). Tests without matrix or cases
+// are returned as they are.
+func expandParams(t map[string]interface{}) ([]map[string]interface{}, error) {
+	matrix, hasMatrix := t["matrix"]
+	cases, hasCases := t["cases"]
+	if !hasMatrix && !hasCases {
+		return []map[string]interface{}{t}, nil
+	}
+	if hasMatrix && hasCases {
+		return nil, fmt.Errorf("test %v: cannot define both matrix and cases", t["name"])
+	}
+
+	var params []map[string]interface{}
+	var err error
+	if hasMatrix {
+		params, err = matrixParams(matrix)
+	} else {
+		params, err = casesParams(cases)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("test %v: %v", t["name"], err)
+	}
+
+	tests := make([]map[string]interface{}, 0, len(params))
+	for _, p := range params {
+		e := make(map[string]interface{})
+		for k, v := range t {
+			if k == "matrix" || k == "cases" {
+				continue
+			}
+			e[k], err = substitute(v, p)
+			if err != nil {
+				return nil, fmt.Errorf("test %v: %v: %v", t["name"], k, err)
+			}
+		}
+		e["name"] = fmt.Sprintf("%v [%v]", e["name"], paramsName(p))
+		tests = append(tests, e)
+	}
+	return tests, nil
+}
+
+// Returns the combinations of the values of a matrix (e.g. {value: [82, 95]}).
+// The values of the first parameter, by name, vary the slowest.
+func matrixParams(m interface{}) ([]map[string]interface{}, error) {
+	mm, ok := m.(map[interface{}]interface{})
+	if !ok || len(mm) == 0 {
+		return nil, fmt.Errorf("matrix must map parameters to lists of values")
+	}
+	names := make([]string, 0, len(mm))
+	values := make(map[string][]interface{})
+	for k, v := range mm {
+		l, ok := v.([]interface{})
+		if !ok || len(l) == 0 {
+			return nil, fmt.Errorf("matrix parameter %v must be a list of values", k)
+		}
+		n := fmt.Sprint(k)
+		names = append(names, n)
+		values[n] = l
+	}
+	sort.Strings(names)
+
+	params := []map[string]interface{}{{}}
+	for _, n := range names {
+		next := make([]map[string]interface{}, 0, len(params)*len(values[n]))
+		for _, p := range params {
+			for _, v := range values[n] {
+				e := make(map[string]interface{}, len(p)+1)
+				for k, pv := range p {
+					e[k] = pv
+				}
+				e[n] = v
+				next = append(next, e)
+			}
+		}
+		params = next
+	}
+	return params, nil
+}
+
+// Returns the parameters of each case (e.g. [{value: 82}, {value: 95}])
+func casesParams(c interface{}) ([]map[string]interface{}, error) {
+	l, ok := c.([]interface{})
+	if !ok || len(l) == 0 {
+		return nil, fmt.Errorf("cases must be a list of parameters")
+	}
+	params := make([]map[string]interface{}, 0, len(l))
+	for _, e := range l {
+		m, ok := e.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("case %v must map parameters to values", e)
+		}
+		p := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			p[fmt.Sprint(k)] = v
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// Replaces the parameter references in a value of a test
+func substitute(v interface{}, p map[string]interface{}) (interface{}, error) {
+	switch e := v.(type) {
+	case string:
+		if m := paramRegexp.FindStringSubmatch(e); m != nil {
+			if pv, ok := p[m[1]]; ok {
+				return pv, nil
+			}
+		}
+		if !strings.Contains(e, "{{") {
+			return e, nil
+		}
+		tmpl, err := template.New("").Option("missingkey=error").Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, p); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	case []interface{}:
+		l := make([]interface{}, len(e))
+		for i, ev := range e {
+			s, err := substitute(ev, p)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = s
+		}
+		return l, nil
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(e))
+		for k, ev := range e {
+			s, err := substitute(ev, p)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = s
+		}
+		return m, nil
+	}
+	return v, nil
+}
+
+// Describes the parameters of a test, sorted by name (e.g. "level=warn,
+// value=82")
+func paramsName(p map[string]interface{}) string {
+	names := make([]string, 0, len(p))
+	for n := range p {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	l := make([]string, 0, len(names))
+	for _, n := range names {
+		l = append(l, fmt.Sprintf("%v=%v", n, p[n]))
+	}
+	return strings.Join(l, ", ")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfigMatrix(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: Alert weather
+   task_name: alert_weather.tick
+   matrix:
+     value: [82, 95]
+     location: [us-east, us-west]
+   data:
+    - "weather,location={{.location}} temperature={{.value}}"
+   expects:
+     warn: 1
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, tst := range tests {
+		names = append(names, tst.Name)
+	}
+	exp := []string{
+		"Alert weather [location=us-east, value=82]",
+		"Alert weather [location=us-east, value=95]",
+		"Alert weather [location=us-west, value=82]",
+		"Alert weather [location=us-west, value=95]",
+	}
+	if !reflect.DeepEqual(names, exp) {
+		t.Error("Matrix should expand into tests ", exp, " got ", names)
+	}
+	if !reflect.DeepEqual(tests[3].Data, []string{"weather,location=us-west temperature=95"}) {
+		t.Error("Parameters not replaced in data: ", tests[3].Data)
+	}
+}
+
+func TestConfigCases(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: Alert weather template
+   template_name: alert_weather_template.tick
+   cases:
+    - {value: 82, warn: 1, crit: 0}
+    - {value: 120, warn: 0, crit: 1}
+   vars:
+     crit:
+       type: int
+       value: "{{.value}}"
+   data:
+    - "weather temperature={{.value}}"
+   expects:
+     warn: "{{.warn}}"
+     crit: "{{.crit}}"
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	tests, err := testConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tests) != 2 || tests[1].Name != "Alert weather template [crit=1, value=120, warn=0]" {
+		t.Fatal("Cases not expanded as expected: ", tests)
+	}
+	if tests[1].Expects.Crit != 1 || tests[1].Expects.Warn != 0 || tests[0].Expects.Warn != 1 {
+		t.Error("Parameters not replaced in expects: ", tests[0].Expects, tests[1].Expects)
+	}
+	if tests[1].Vars["crit"].Value != 120 {
+		t.Error("Parameter should keep its type in vars, got ", tests[1].Vars["crit"].Value)
+	}
+}
+
+func TestConfigUnknownParam(t *testing.T) {
+	p := "./conf.yaml"
+	c := `
+tests:
+ - name: Alert weather
+   task_name: alert_weather.tick
+   cases:
+    - {value: 82}
+   data:
+    - "weather temperature={{.temperature}}"
+`
+	defer os.Remove(p)
+	createConfFile(p, c)
+	_, err := testConfig(p)
+	if err == nil {
+		t.Error("Unknown parameters should fail to load")
+	}
+}
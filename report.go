@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// Result of a test in the JSON report of a test run
+type reportEntry struct {
+	File     string  `json:"file"`
+	Name     string  `json:"name"`
+	Task     string  `json:"task"`
+	Status   string  `json:"status"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration"`
+}
+
+// Writes the results and durations, in seconds, of the tests to a JSON file.
+// Reports of the shards of a suite can be merged by concatenating their
+// entries.
+func writeReport(path string, tests TestCollection) error {
+	r := make([]reportEntry, 0, len(tests))
+	for _, t := range tests {
+		r = append(r, reportEntry{
+			File:     t.File,
+			Name:     t.Name,
+			Task:     t.ScriptName(),
+			Status:   outcome(t.Result),
+			Message:  t.Result.Message,
+			Duration: t.Duration.Seconds(),
+		})
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Reads the durations of the tests that ran in a previous run from its JSON
+// report, by configuration file and test name
+func readTimings(path string) (map[string]time.Duration, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := []reportEntry{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	d := make(map[string]time.Duration)
+	for _, e := range r {
+		if e.Status != skipped {
+			d[testKey(e.File, e.Name)] = time.Duration(e.Duration * float64(time.Second))
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/gpestana/kapacitor-unit/test"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReportTimings(t *testing.T) {
+	p := "./report.json"
+	defer os.Remove(p)
+	tests := TestCollection{
+		{Name: "passed", File: "t.yaml", Result: test.Result{Passed: true}, Duration: 2 * time.Second},
+		{Name: "failed", File: "t.yaml", Result: test.Result{Message: "1 CRIT expected"}, Duration: 500 * time.Millisecond},
+		{Name: "skipped", File: "t.yaml", Result: test.Result{Skipped: true}},
+	}
+	if err := writeReport(p, tests); err != nil {
+		t.Fatal(err)
+	}
+	timings, err := readTimings(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timings) != 2 {
+		t.Error("Timings should include the tests that ran, got ", timings)
+	}
+	if timings["t.yaml:passed"] != 2*time.Second || timings["t.yaml:failed"] != 500*time.Millisecond {
+		t.Error("Unexpected timings: ", timings)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/gpestana/kapacitor-unit/cli"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/test"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runs the before_all hooks, the tests and the after_all hooks, printing the
+// test results in order. Returns the summary of the run and whether the
+// after_all hooks succeeded. The after_all hooks also run when the context is
+// cancelled or the suite timeout expires, once the running tests finished.
+func runSuite(ctx context.Context, tests TestCollection, k io.TaskBackend, i io.DataBackend, f *cli.Config) (summary, bool) {
+	if f.SuiteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.SuiteTimeout)
+		defer cancel()
+	}
+
+	// Runs the before_all hooks of each test file. If they fail, the tests of
+	// the file are not run.
+	for _, h := range fileHooks(tests) {
+		if err := test.RunHooks(h.BeforeAll); err != nil {
+			m := "before_all hook: " + err.Error()
+			for j := range tests {
+				if tests[j].Hooks == h {
+					tests[j].Result = test.Result{Message: m, Error: true}
+				}
+			}
+		}
+	}
+
+	// Validates, runs tests and print results in order
+	start := time.Now()
+	done := runTests(ctx, tests, k, i, f.Parallel, f.Count, f.FailFast)
+	for j := range tests {
+		<-done[j]
+		//Prints test output
+		setColor(tests[j])
+		log.Println(tests[j])
+		color.Unset()
+	}
+	s := summarize(tests, time.Since(start))
+
+	// Runs the after_all hooks of each test file
+	hooksOk := true
+	for _, h := range fileHooks(tests) {
+		if err := test.RunAllHooks(h.AfterAll); err != nil {
+			log.Println("Error running after_all hook: ", err)
+			hooksOk = false
+		}
+	}
+	return s, hooksOk
+}
+
+// Returns the hooks of the files of the tests, in the order of the tests
+func fileHooks(tests TestCollection) []*test.Hooks {
+	hooks := []*test.Hooks{}
+	seen := make(map[*test.Hooks]bool)
+	for _, t := range tests {
+		if t.Hooks != nil && !seen[t.Hooks] {
+			seen[t.Hooks] = true
+			hooks = append(hooks, t.Hooks)
+		}
+	}
+	return hooks
+}
+
+// Runs each test count times with a pool of n workers. Returns a channel per
+// test, closed when the test finishes. With failFast, the tests not started yet when a test
+// does not pass are skipped. The tests not started yet when the context is
+// done are skipped too, while the running ones finish and tear down.
+func runTests(ctx context.Context, tests TestCollection, k io.TaskBackend, i io.DataBackend, n int, count int, failFast bool) []chan struct{} {
+	done := make([]chan struct{}, len(tests))
+	for j := range done {
+		done[j] = make(chan struct{})
+	}
+	var stop sync.Once
+	stopped := make(chan struct{})
+	jobs := make(chan int)
+	for w := 0; w < n; w++ {
+		go func() {
+			for j := range jobs {
+				if reason := skipReason(ctx, stopped); reason != "" {
+					skip(&tests[j], reason)
+					close(done[j])
+					continue
+				}
+				runTest(ctx, &tests[j], k, i, count)
+				if failFast && !tests[j].Result.Passed {
+					stop.Do(func() { close(stopped) })
+				}
+				close(done[j])
+			}
+		}()
+	}
+	go func() {
+		for j := range tests {
+			select {
+			case <-stopped:
+				skip(&tests[j], skipFailed)
+				close(done[j])
+			case <-ctx.Done():
+				skip(&tests[j], doneReason(ctx))
+				close(done[j])
+			case jobs <- j:
+			}
+		}
+		close(jobs)
+	}()
+	return done
+}
+
+const (
+	skipFailed      = "not run after a test did not pass"
+	skipInterrupted = "not run after the run was interrupted"
+	skipTimedOut    = "not run after the suite timeout expired"
+)
+
+// Returns why a test must be skipped, if the run was interrupted, the suite
+// timed out or a test did not pass with failFast, or an empty string otherwise
+func skipReason(ctx context.Context, stopped chan struct{}) string {
+	select {
+	case <-ctx.Done():
+		return doneReason(ctx)
+	case <-stopped:
+		return skipFailed
+	default:
+		return ""
+	}
+}
+
+// Returns why the tests not started yet are skipped once the context is done
+func doneReason(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return skipTimedOut
+	}
+	return skipInterrupted
+}
+
+// Marks a test as skipped
+func skip(t *test.Test, reason string) {
+	t.Result = test.Result{Message: reason, Skipped: true}
+}
+
+// Validates and runs a test count times, unless the context is cancelled.
+// Errors are saved in the test result. The results of a test run several
+// times are saved in its runs, and its result is the one of the first run
+// that did not pass on the first attempt, or of the last run.
+func runTest(ctx context.Context, t *test.Test, k io.TaskBackend, i io.DataBackend, count int) {
+	start := time.Now()
+	defer func() {
+		t.Duration = time.Since(start)
+	}()
+	t.Validate()
+	// Runs the test only if there was no errors during constructor and validation
+	if t.Result.Error == true {
+		return
+	}
+	for r := 1; r == 1 || r <= count; r++ {
+		runAttempts(ctx, t, k, i)
+		if count > 1 {
+			t.Runs = append(t.Runs, t.Result)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	for _, r := range t.Runs {
+		if !r.Passed || r.Flaky {
+			t.Result = r
+			break
+		}
+	}
+}
+
+// Runs a test. A test that does not pass is run again up to its number of
+// retries, unless the context is cancelled, and is marked as flaky if it
+// passes on a retry.
+func runAttempts(ctx context.Context, t *test.Test, k io.TaskBackend, i io.DataBackend) {
+	for attempt := 1; ; attempt++ {
+		t.Result = test.Result{}
+		err := t.Run(k, i)
+		if err != nil {
+			t.Result = test.Result{Message: err.Error(), Error: true}
+		}
+		if t.Result.Passed {
+			if attempt > 1 {
+				t.Result.Flaky = true
+				t.Result.Message = fmt.Sprintf("%v (passed on attempt %d of %d)", t.Result.Message, attempt, t.Retries+1)
+			}
+			return
+		}
+		if attempt > t.Retries || ctx.Err() != nil {
+			return
+		}
+		log.Println("Retrying test ", t.Name, " after: ", t.Result.Message)
+	}
+}
+
+// Sets output color based on test results
+func setColor(t test.Test) {
+	if t.Result.Flaky == true {
+		color.Set(color.FgYellow)
+	} else if t.Result.Passed == true {
+		color.Set(color.FgGreen)
+	} else if t.Result.Timeout == true || t.Result.Skipped == true {
+		color.Set(color.FgYellow)
+	} else {
+		color.Set(color.FgRed)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/cli"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/io/kapacitortest"
+	"github.com/gpestana/kapacitor-unit/test"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunTestsParallel(t *testing.T) {
+	tests := TestCollection{
+		{Name: "invalid", TaskName: "a.tick", TemplateName: "b.tick"},
+		{Name: "unreachable 1", TaskName: "a.tick", Type: "stream"},
+		{Name: "unreachable 2", TaskName: "b.tick", Type: "stream"},
+	}
+	k := io.NewKapacitor("http://127.0.0.1:1")
+	i := io.NewInfluxdb("http://127.0.0.1:1")
+
+	done := runTests(context.Background(), tests, k, i, 2, 1, false)
+	for j := range done {
+		<-done[j]
+	}
+
+	for _, tst := range tests {
+		if tst.Result.Error != true || tst.Result.Message == "" {
+			t.Error("Test should have errored: ", tst)
+		}
+	}
+	if !strings.Contains(tests[0].Result.Message, "template_name") {
+		t.Error("Validation error not saved in the test result: ", tests[0].Result.Message)
+	}
+	if tests[1].Name != "unreachable 1" || tests[2].Name != "unreachable 2" {
+		t.Error("Tests order should not change")
+	}
+}
+
+func TestRunTestsFailFast(t *testing.T) {
+	tests := TestCollection{
+		{Name: "invalid", TaskName: "a.tick", TemplateName: "b.tick"},
+		{Name: "unreachable 1", TaskName: "a.tick", Type: "stream"},
+		{Name: "unreachable 2", TaskName: "b.tick", Type: "stream"},
+	}
+	k := io.NewKapacitor("http://127.0.0.1:1")
+	i := io.NewInfluxdb("http://127.0.0.1:1")
+
+	done := runTests(context.Background(), tests, k, i, 1, 1, true)
+	for j := range done {
+		<-done[j]
+	}
+
+	if tests[0].Result.Error != true {
+		t.Error("First test should have errored: ", tests[0])
+	}
+	for _, tst := range tests[1:] {
+		if tst.Result.Skipped != true {
+			t.Error("Test should have been skipped after the first failure: ", tst)
+		}
+	}
+}
+
+func TestRunSuiteInterrupted(t *testing.T) {
+	f, err := ioutil.TempFile("", "after_all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	hooks := &test.Hooks{AfterAll: []test.Hook{{Command: "echo ran >> " + f.Name()}}}
+	tests := TestCollection{
+		{Name: "a", TaskName: "a.tick", Type: "stream", Hooks: hooks},
+		{Name: "b", TaskName: "b.tick", Type: "stream", Hooks: hooks},
+	}
+	k := io.NewKapacitor("http://127.0.0.1:1")
+	i := io.NewInfluxdb("http://127.0.0.1:1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sum, _ := runSuite(ctx, tests, k, i, &cli.Config{Parallel: 1})
+	if sum.Skipped != 2 {
+		t.Error("Tests not started when the run is interrupted should be skipped: ", sum)
+	}
+	b, _ := ioutil.ReadFile(f.Name())
+	if string(b) != "ran\n" {
+		t.Error("after_all hooks should run when the run is interrupted")
+	}
+}
+
+func TestRunSuiteTimeout(t *testing.T) {
+	s := kapacitortest.NewServer()
+	defer s.Close()
+	s.SetNodeStats("a", map[string]map[string]int{"alert2": {"crits_triggered": 1}})
+
+	tests := TestCollection{
+		{Name: "a", Id: "a", TaskName: "a.tick", Type: "stream", Data: []string{"cpu value=1"}, Expects: test.Result{Crit: 1}},
+		{Name: "b", Id: "b", TaskName: "b.tick", Type: "stream", Data: []string{"cpu value=1"}, Expects: test.Result{Crit: 1}},
+	}
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	// The first test runs past the suite timeout, waiting for its stats to
+	// settle, so the second test is not started
+	sum, _ := runSuite(context.Background(), tests, k, i, &cli.Config{Parallel: 1, SuiteTimeout: 100 * time.Millisecond})
+	if !tests[0].Result.Passed {
+		t.Error("Test started before the suite timeout should finish: ", tests[0].Result)
+	}
+	if sum.Skipped != 1 || tests[1].Result.Message != skipTimedOut {
+		t.Error("Tests not started when the suite timeout expires should be skipped: ", sum, tests[1].Result)
+	}
+}
+
+// Kapacitor where the task triggers a critical alert only from the given
+// attempt (i.e. task load) onwards
+func flakyKapacitor(passFrom int) *httptest.Server {
+	var mu sync.Mutex
+	attempt := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "POST":
+			attempt++
+		case "GET":
+			crits := 0
+			if attempt >= passFrom {
+				crits = 1
+			}
+			fmt.Fprintf(w, `{"stats": {"node-stats": {"alert2": {"crits_triggered": %d}}}}`, crits)
+		}
+	}))
+}
+
+func TestRunTestRetries(t *testing.T) {
+	s := flakyKapacitor(2)
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	tst := test.Test{Name: "flaky", TaskName: "a.tick", Type: "stream", Retries: 1, Expects: test.Result{Crit: 1}}
+	runTest(context.Background(), &tst, k, i, 1)
+	if !tst.Result.Passed || !tst.Result.Flaky {
+		t.Error("Test should pass on retry and be marked as flaky: ", tst.Result)
+	}
+	if !strings.HasPrefix(tst.String(), "TEST flaky (a.tick) FLAKY-PASSED: OK (passed on attempt 2 of 2)") {
+		t.Error("Unexpected test output: ", tst.String())
+	}
+}
+
+func TestRunTestRetriesExhausted(t *testing.T) {
+	s := flakyKapacitor(3)
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	tst := test.Test{Name: "failing", TaskName: "a.tick", Type: "stream", Retries: 1, Expects: test.Result{Crit: 1}}
+	runTest(context.Background(), &tst, k, i, 1)
+	if tst.Result.Passed || tst.Result.Flaky {
+		t.Error("Test should fail after its retries: ", tst.Result)
+	}
+}
+
+func TestRunTestCount(t *testing.T) {
+	s := flakyKapacitor(2)
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	tst := test.Test{Name: "flaky", TaskName: "a.tick", Type: "stream", Expects: test.Result{Crit: 1}}
+	runTest(context.Background(), &tst, k, i, 3)
+	if len(tst.Runs) != 3 || tst.Runs[0].Passed || !tst.Runs[1].Passed || !tst.Runs[2].Passed {
+		t.Error("Test should run 3 times, failing only the first time: ", tst.Runs)
+	}
+	if tst.Result.Passed {
+		t.Error("Result of the test should be the one of its failed run: ", tst.Result)
+	}
+}
+
+func TestRunSuiteFakeKapacitor(t *testing.T) {
+	s := kapacitortest.NewServer()
+	defer s.Close()
+	// Tasks trigger a critical alert for each point with value=99
+	s.SetNodeStatsFunc(func(id string, points []string) map[string]map[string]int {
+		crits := 0
+		for _, p := range points {
+			if strings.HasSuffix(p, "value=99") {
+				crits++
+			}
+		}
+		return map[string]map[string]int{"alert2": {"crits_triggered": crits}}
+	})
+	k := io.NewKapacitor(s.URL)
+	i := io.NewInfluxdb(s.URL)
+
+	tests := TestCollection{
+		{Name: "crit", Id: "ku-0", TaskName: "a.tick", Type: "stream", Db: "db", Rp: "rp",
+			Data: []string{"cpu value=99"}, Expects: test.Result{Crit: 1}},
+		{Name: "no alert", Id: "ku-1", TaskName: "a.tick", Type: "stream", Db: "db", Rp: "rp",
+			Data: []string{"cpu value=1"}, Expects: test.Result{Crit: 1}},
+	}
+	sum, hooksOk := runSuite(context.Background(), tests, k, i, &cli.Config{Parallel: 1})
+	if sum.Passed != 1 || sum.Failed != 1 || !hooksOk {
+		t.Error("Unexpected summary: ", sum)
+	}
+	if len(s.Tasks()) != 0 {
+		t.Error("Tasks should be deleted after the tests: ", s.Tasks())
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/gpestana/kapacitor-unit/test"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Returns the key identifying a test across runs, shards and reports, from
+// its configuration file and name
+func resultKey(t test.Test) string {
+	return testKey(t.File, t.Name)
+}
+
+// The path of the configuration file is made relative to the working
+// directory and cleaned, so that ./a.yaml, a.yaml and its absolute path give
+// the same key on every machine
+func testKey(file string, name string) string {
+	if filepath.IsAbs(file) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, file); err == nil {
+				file = rel
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(file)) + ":" + name
+}
+
+// Selects the tests of shard i (1 to n) of the suite. Every shard selects a
+// disjoint subset of the tests. Without timings, tests are assigned by hashing
+// their configuration file and name. With the durations of a previous run,
+// each test, slowest first, is assigned to the shard with the least total
+// duration so far; tests missing from the timings count as the average
+// duration.
+func shardTests(c TestCollection, i int, n int, timings map[string]time.Duration) TestCollection {
+	if n <= 1 {
+		return c
+	}
+	shard := make([]int, len(c))
+	if len(timings) == 0 {
+		for j, t := range c {
+			h := fnv.New32a()
+			h.Write([]byte(resultKey(t)))
+			shard[j] = int(h.Sum32() % uint32(n))
+		}
+	} else {
+		balanceShards(c, n, timings, shard)
+	}
+
+	tests := make(TestCollection, 0, len(c)/n+1)
+	for j, t := range c {
+		if shard[j] == i-1 {
+			tests = append(tests, t)
+		}
+	}
+	return tests
+}
+
+// Assigns the tests to n shards balanced by duration, saving the shard of each
+// test in shard
+func balanceShards(c TestCollection, n int, timings map[string]time.Duration, shard []int) {
+	var total time.Duration
+	for _, d := range timings {
+		total += d
+	}
+	avg := total / time.Duration(len(timings))
+
+	d := make([]time.Duration, len(c))
+	order := make([]int, len(c))
+	for j, t := range c {
+		order[j] = j
+		if td, ok := timings[resultKey(t)]; ok {
+			d[j] = td
+		} else {
+			d[j] = avg
+		}
+	}
+	// Sorting by key on equal durations keeps the assignment independent of the
+	// order in which tests were discovered
+	sort.SliceStable(order, func(a, b int) bool {
+		if d[order[a]] != d[order[b]] {
+			return d[order[a]] > d[order[b]]
+		}
+		return resultKey(c[order[a]]) < resultKey(c[order[b]])
+	})
+
+	load := make([]time.Duration, n)
+	for _, j := range order {
+		s := 0
+		for k := 1; k < n; k++ {
+			if load[k] < load[s] {
+				s = k
+			}
+		}
+		shard[j] = s
+		load[s] += d[j]
+	}
+}
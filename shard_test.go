@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/test"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func shardTestCollection(n int) TestCollection {
+	tests := TestCollection{}
+	for j := 0; j < n; j++ {
+		tests = append(tests, test.Test{Name: fmt.Sprintf("test %d", j)})
+	}
+	return tests
+}
+
+func TestResultKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"tests/a.yaml", "./tests/a.yaml", "tests//a.yaml", filepath.Join(wd, "tests", "a.yaml")} {
+		if k := resultKey(test.Test{File: f, Name: "a"}); k != "tests/a.yaml:a" {
+			t.Error("Key of a test in ", f, " should be tests/a.yaml:a, got ", k)
+		}
+	}
+}
+
+func TestShardTestsDisjoint(t *testing.T) {
+	tests := shardTestCollection(20)
+	seen := make(map[string]int)
+	for i := 1; i <= 3; i++ {
+		for _, tst := range shardTests(tests, i, 3, nil) {
+			seen[tst.Name]++
+		}
+	}
+	if len(seen) != len(tests) {
+		t.Error("Shards should cover all tests, got ", len(seen))
+	}
+	for name, n := range seen {
+		if n != 1 {
+			t.Error("Test ", name, " selected by ", n, " shards")
+		}
+	}
+}
+
+func TestShardTestsDeterministic(t *testing.T) {
+	tests := shardTestCollection(20)
+	reordered := append(TestCollection{}, tests[10:]...)
+	reordered = append(reordered, tests[:10]...)
+	a := shardTests(tests, 2, 3, nil)
+	b := shardTests(reordered, 2, 3, nil)
+	names := make(map[string]bool)
+	for _, tst := range a {
+		names[tst.Name] = true
+	}
+	if len(a) != len(b) {
+		t.Fatal("Shard should not depend on the order of the tests")
+	}
+	for _, tst := range b {
+		if !names[tst.Name] {
+			t.Error("Shard should not depend on the order of the tests")
+		}
+	}
+}
+
+func TestShardTestsBalanced(t *testing.T) {
+	tests := shardTestCollection(4)
+	timings := map[string]time.Duration{
+		":test 0": 10 * time.Second,
+		":test 1": 6 * time.Second,
+		":test 2": 4 * time.Second,
+	}
+	// test 3 counts as the average duration, about 6.7s
+	s1 := shardTests(tests, 1, 2, timings)
+	s2 := shardTests(tests, 2, 2, timings)
+	if len(s1) != 2 || s1[0].Name != "test 0" || s1[1].Name != "test 2" {
+		t.Error("Unexpected tests in shard 1: ", s1)
+	}
+	if len(s2) != 2 || s2[0].Name != "test 1" || s2[1].Name != "test 3" {
+		t.Error("Unexpected tests in shard 2: ", s2)
+	}
+}
+
+func TestShardTestsSingleShard(t *testing.T) {
+	tests := shardTestCollection(5)
+	if len(shardTests(tests, 1, 1, nil)) != 5 {
+		t.Error("A single shard should select all tests")
+	}
+}
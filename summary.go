@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/test"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Number of slowest tests listed in the summary
+const slowestTests = 5
+
+// Outcomes of a test
+const (
+	passed      = "passed"
+	flakyPassed = "flaky-passed"
+	failed      = "failed"
+	errored     = "errored"
+	timedOut    = "timed out"
+	skipped     = "skipped"
+)
+
+// Returns the outcome of the result of a test that ran
+func outcome(r test.Result) string {
+	switch {
+	case r.Skipped:
+		return skipped
+	case r.Timeout:
+		return timedOut
+	case r.Error:
+		return errored
+	case r.Flaky:
+		return flakyPassed
+	case r.Passed:
+		return passed
+	default:
+		return failed
+	}
+}
+
+// Outcome of a test run
+type summary struct {
+	Passed      int
+	FlakyPassed int
+	Failed      int
+	Errored     int
+	TimedOut    int
+	Skipped     int
+	Duration    time.Duration
+	Slowest     TestCollection
+}
+
+// Counts the tests by outcome and finds the slowest tests
+func summarize(tests TestCollection, d time.Duration) summary {
+	s := summary{Duration: d}
+	for _, t := range tests {
+		switch outcome(t.Result) {
+		case skipped:
+			s.Skipped++
+		case timedOut:
+			s.TimedOut++
+		case errored:
+			s.Errored++
+		case flakyPassed:
+			s.FlakyPassed++
+		case passed:
+			s.Passed++
+		default:
+			s.Failed++
+		}
+	}
+
+	s.Slowest = make(TestCollection, 0, len(tests))
+	for _, t := range tests {
+		if t.Duration > 0 {
+			s.Slowest = append(s.Slowest, t)
+		}
+	}
+	sort.SliceStable(s.Slowest, func(i, j int) bool {
+		return s.Slowest[i].Duration > s.Slowest[j].Duration
+	})
+	if len(s.Slowest) > slowestTests {
+		s.Slowest = s.Slowest[:slowestTests]
+	}
+	return s
+}
+
+// Checks if all tests that ran passed
+func (s summary) Ok() bool {
+	return s.Failed == 0 && s.Errored == 0 && s.TimedOut == 0
+}
+
+func (s summary) String() string {
+	flaky := ""
+	if s.FlakyPassed > 0 {
+		flaky = fmt.Sprintf("%v flaky-passed, ", s.FlakyPassed)
+	}
+	l := []string{
+		fmt.Sprintf("%v passed, %v%v failed, %v errored, %v timed out, %v skipped in %v",
+			s.Passed, flaky, s.Failed, s.Errored, s.TimedOut, s.Skipped, s.Duration.Round(time.Millisecond)),
+	}
+	if len(s.Slowest) > 0 {
+		l = append(l, "Slowest tests:")
+		for _, t := range s.Slowest {
+			l = append(l, fmt.Sprintf("  %v %v (%v)", t.Duration.Round(time.Millisecond), t.Name, t.ScriptName()))
+		}
+	}
+	return strings.Join(l, "\n")
+}
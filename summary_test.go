@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/gpestana/kapacitor-unit/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	tests := TestCollection{
+		{Name: "passed", Result: test.Result{Passed: true}, Duration: 2 * time.Second},
+		{Name: "failed", Result: test.Result{}, Duration: 3 * time.Second},
+		{Name: "errored", Result: test.Result{Error: true}, Duration: time.Second},
+		{Name: "timeout", Result: test.Result{Timeout: true}, Duration: 30 * time.Second},
+		{Name: "skipped", Result: test.Result{Skipped: true}},
+	}
+
+	s := summarize(tests, time.Minute)
+
+	if s.Passed != 1 || s.Failed != 1 || s.Errored != 1 || s.TimedOut != 1 || s.Skipped != 1 {
+		t.Error("Tests not counted as expected: ", s)
+	}
+	if s.Ok() {
+		t.Error("Summary with failed tests should not be ok")
+	}
+	if len(s.Slowest) != 4 || s.Slowest[0].Name != "timeout" || s.Slowest[3].Name != "errored" {
+		t.Error("Slowest tests not sorted as expected: ", s.Slowest)
+	}
+	if !strings.HasPrefix(s.String(), "1 passed, 1 failed, 1 errored, 1 timed out, 1 skipped in 1m0s") {
+		t.Error("Unexpected summary: ", s.String())
+	}
+}
+
+func TestSummarizeOk(t *testing.T) {
+	tests := TestCollection{
+		{Name: "passed", Result: test.Result{Passed: true}},
+	}
+	if !summarize(tests, time.Second).Ok() {
+		t.Error("Summary with only passed tests should be ok")
+	}
+}
+
+func TestSummarizeFlaky(t *testing.T) {
+	tests := TestCollection{
+		{Name: "passed", Result: test.Result{Passed: true}},
+		{Name: "flaky", Result: test.Result{Passed: true, Flaky: true}},
+	}
+	s := summarize(tests, time.Second)
+	if s.Passed != 1 || s.FlakyPassed != 1 || !s.Ok() {
+		t.Error("Flaky tests not counted as expected: ", s)
+	}
+	if !strings.HasPrefix(s.String(), "1 passed, 1 flaky-passed, 0 failed") {
+		t.Error("Unexpected summary: ", s.String())
+	}
+}
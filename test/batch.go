@@ -0,0 +1,151 @@
+package test
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Batch queries are executed every second while testing (see
+// io.batchReplaceEvery), which is the interval used to find when the next
+// query execution happens
+const batchEvery = time.Second
+
+// Time window read by the query of a batch TICKscript, as defined by the
+// query node properties .period(), .offset() and .align()
+type batchWindow struct {
+	period time.Duration
+	offset time.Duration
+	align  bool
+}
+
+// Parses the window properties of the first query node of a batch TICKscript
+func parseBatchWindow(script string) (batchWindow, error) {
+	w := batchWindow{}
+	s, err := queryProperties(script)
+	if err != nil {
+		return w, err
+	}
+
+	m := regexp.MustCompile(`\.period\(\s*([^)\s]*)\s*\)`).FindStringSubmatch(s)
+	if m == nil {
+		return w, errors.New("batch TICKscript query does not define a .period()")
+	}
+	w.period, err = parseDuration(m[1])
+	if err != nil {
+		return w, err
+	}
+	if m := regexp.MustCompile(`\.offset\(\s*([^)\s]*)\s*\)`).FindStringSubmatch(s); m != nil {
+		w.offset, err = parseDuration(m[1])
+		if err != nil {
+			return w, err
+		}
+	}
+	w.align = regexp.MustCompile(`\.align\(\s*\)`).MatchString(s)
+	return w, nil
+}
+
+// Returns the chained properties of the first query node of the script, i.e.
+// everything after the query text up to the next node or variable declaration
+func queryProperties(script string) (string, error) {
+	i := strings.Index(script, "query(")
+	if i < 0 {
+		return "", errors.New("batch TICKscript does not define a query")
+	}
+	s := strings.TrimLeft(script[i+len("query("):], " \t\r\n")
+	// Skips the query text, which may be either a triple or single quoted string
+	n := quotedLen(s)
+	if n < 0 {
+		return "", errors.New("batch TICKscript query text is not a quoted string")
+	}
+	s = strings.TrimLeft(s[n:], " \t\r\n")
+	if !strings.HasPrefix(s, ")") {
+		return "", errors.New("batch TICKscript query is not closed")
+	}
+	s = s[1:]
+
+	// The properties end at the next chained node or variable declaration,
+	// ignoring any | inside the string literals of the properties
+	for j := 0; j < len(s); j++ {
+		switch {
+		case s[j] == '\'' || s[j] == '"':
+			n := quotedLen(s[j:])
+			if n < 0 {
+				return "", errors.New("batch TICKscript query has an unterminated string")
+			}
+			j += n - 1
+		case s[j] == '|' || strings.HasPrefix(s[j:], "\nvar "):
+			return s[:j], nil
+		}
+	}
+	return s, nil
+}
+
+// Returns the length of the TICKscript string literal or quoted reference at
+// the start of s, including its quotes, or -1 if s does not start with a
+// terminated one
+func quotedLen(s string) int {
+	if strings.HasPrefix(s, "'''") {
+		if j := strings.Index(s[3:], "'''"); j >= 0 {
+			return j + 6
+		}
+		return -1
+	}
+	if s == "" || (s[0] != '\'' && s[0] != '"') {
+		return -1
+	}
+	for j := 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case s[0]:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// Returns the time window that the next execution of the batch query after
+// now will read
+func (w batchWindow) next(now time.Time) (time.Time, time.Time) {
+	t := now.Add(batchEvery)
+	if w.align {
+		t = now.Truncate(batchEvery).Add(batchEvery)
+	}
+	end := t.Add(-w.offset)
+	return end.Add(-w.period), end
+}
+
+// Adds timestamps to the data points without one, so that they are spread
+// evenly inside the window read by the next batch query execution
+func (w batchWindow) timestamp(data []string, now time.Time) []string {
+	start, end := w.next(now)
+	return timestampData(data, start, end)
+}
+
+var durationRegexp = regexp.MustCompile(`^(\d+)(u|µ|ms|s|m|h|d|w)$`)
+
+// Parses a TICKscript duration literal (e.g. 10s, 5m, 1d)
+func parseDuration(s string) (time.Duration, error) {
+	m := durationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("invalid duration in TICKscript: " + s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	units := map[string]time.Duration{
+		"u":  time.Microsecond,
+		"µ":  time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+	}
+	return time.Duration(n) * units[m[2]], nil
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBatchWindow(t *testing.T) {
+	s := `
+var weather = batch
+	| query('''
+		SELECT mean(temperature)
+		FROM "weather"."default"."temperature"
+		''')
+			.period(5m)
+			.offset(1h)
+			.every(10m)
+			.align()
+
+var rain = batch
+	| query('''
+		SELECT count(rain)
+		FROM "weather"."default"."temperature"
+	''')
+		.period(1d)
+		.every(3d)
+
+	weather
+	| window()
+		.period(2m)
+		.every(1m)
+		.align()
+`
+	w, err := parseBatchWindow(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.period != 5*time.Minute || w.offset != time.Hour || w.align != true {
+		t.Error("Window not parsed as expected: ", w)
+	}
+}
+
+func TestParseBatchWindowSingleQuoted(t *testing.T) {
+	s := `batch|query('SELECT mean(value) FROM "db"."rp"."cpu"').period(30s).every(1m)|alert()`
+	w, err := parseBatchWindow(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.period != 30*time.Second || w.offset != 0 || w.align != false {
+		t.Error("Window not parsed as expected: ", w)
+	}
+}
+
+func TestParseBatchWindowInvalidDuration(t *testing.T) {
+	s := `batch|query('SELECT mean(value) FROM "db"."rp"."cpu"').period(1y)`
+	_, err := parseBatchWindow(s)
+	if err == nil {
+		t.Error("Invalid duration should return error")
+	}
+}
+
+func TestBatchWindowNext(t *testing.T) {
+	now := time.Date(2018, 1, 1, 10, 0, 0, 500000000, time.UTC)
+
+	w := batchWindow{period: 5 * time.Minute, offset: time.Hour, align: true}
+	start, end := w.next(now)
+	expEnd := time.Date(2018, 1, 1, 9, 0, 1, 0, time.UTC)
+	if !end.Equal(expEnd) || !start.Equal(expEnd.Add(-5*time.Minute)) {
+		t.Error("Aligned window not as expected: ", start, end)
+	}
+
+	w = batchWindow{period: 5 * time.Minute}
+	start, end = w.next(now)
+	expEnd = now.Add(time.Second)
+	if !end.Equal(expEnd) || !start.Equal(expEnd.Add(-5*time.Minute)) {
+		t.Error("Window not as expected: ", start, end)
+	}
+}
+
+func TestBatchWindowTimestamp(t *testing.T) {
+	now := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	w := batchWindow{period: 3 * time.Minute, offset: time.Minute, align: true}
+	d := []string{
+		"temperature,location=us-midwest temperature=110",
+		"temperature,location=us-midwest temperature=91 1514800000000000000",
+		"temperature,location=us-midwest temperature=90",
+	}
+
+	r := w.timestamp(d, now)
+
+	start, end := w.next(now)
+	for i, l := range []int{0, 2} {
+		p := strings.Split(r[l], " ")
+		ts, err := strconv.ParseInt(p[len(p)-1], 10, 64)
+		if err != nil {
+			t.Fatal("Timestamp not added to ", r[l])
+		}
+		exp := start.Add(time.Duration(l+1) * end.Sub(start) / 4)
+		if ts != exp.UnixNano() {
+			t.Error(i, ": timestamp should be ", exp, " got ", time.Unix(0, ts).UTC())
+		}
+	}
+	if r[1] != d[1] {
+		t.Error("Data point with timestamp should not change: ", r[1])
+	}
+}
+
+func TestParseBatchWindowQueryWithPipe(t *testing.T) {
+	s := `batch
+	|query('SELECT mean(value) FROM "db"."rp"."cpu" WHERE host =~ /a|b/')
+		.period(30s)
+		.groupBy('host|region')
+		.offset(10s)
+	|alert()
+		.crit(lambda: "mean" > 90)
+		.period(1m)`
+	w, err := parseBatchWindow(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.period != 30*time.Second || w.offset != 10*time.Second {
+		t.Error("Window not parsed as expected: ", w)
+	}
+}
+
+func TestParseBatchWindowNoPeriod(t *testing.T) {
+	for _, s := range []string{
+		`batch|query('SELECT mean(value) FROM "db"."rp"."cpu"').every(1m)|alert().period(1m)`,
+		`batch|query('SELECT mean(value) FROM "db"."rp"."cpu"`,
+		`batch|query(SELECT mean(value)).period(1m)`,
+		`stream|from().measurement('cpu')`,
+	} {
+		if _, err := parseBatchWindow(s); err == nil {
+			t.Error("Query without a valid .period() should return error: ", s)
+		}
+	}
+}
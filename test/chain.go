@@ -0,0 +1,142 @@
+package test
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/task"
+	"strings"
+)
+
+// Task of a test that loads several chained tasks, e.g. a task that writes
+// derived points with kapacitorLoopback() and a task that alerts on them
+type ChainedTask struct {
+	TaskName     string         `yaml:"task_name,omitempty"`
+	TemplateName string         `yaml:"template_name,omitempty"`
+	Vars         map[string]Var `yaml:"vars,omitempty"`
+	// Alerts expected to be triggered by the task, if defined
+	Expects *Result   `yaml:"expects,omitempty"`
+	Result  Result    `yaml:"-"`
+	Task    task.Task `yaml:"-"`
+}
+
+// Returns the name of the TICKscript file of the task
+func (c ChainedTask) ScriptName() string {
+	if c.TemplateName != "" {
+		return c.TemplateName
+	}
+	return c.TaskName
+}
+
+// Turns the task_names of a test into tasks, and makes the first of the tasks
+// of a multi-task test the task of the test, which the test data is written to
+func (t *Test) ExpandTasks() {
+	if len(t.TaskNames) > 0 && len(t.Tasks) == 0 {
+		for _, n := range t.TaskNames {
+			t.Tasks = append(t.Tasks, ChainedTask{TaskName: n})
+		}
+		t.TaskNames = nil
+	}
+	if len(t.Tasks) == 0 || t.TaskName != "" || t.TemplateName != "" || len(t.Vars) > 0 {
+		return
+	}
+	t.TaskName = t.Tasks[0].TaskName
+	t.TemplateName = t.Tasks[0].TemplateName
+	t.Vars = t.Tasks[0].Vars
+}
+
+// Checks if the test defines its tasks as a list of tasks
+func (t *Test) chained() bool {
+	return len(t.Tasks) > 0
+}
+
+// Returns the names of the TICKscript files of all tasks of the test
+func (t Test) ScriptNames() []string {
+	n := []string{t.ScriptName()}
+	for _, c := range t.downstream() {
+		n = append(n, c.ScriptName())
+	}
+	return n
+}
+
+// Returns the tasks loaded after the task the test data is written to
+func (t *Test) downstream() []ChainedTask {
+	if len(t.Tasks) < 2 {
+		return nil
+	}
+	return t.Tasks[1:]
+}
+
+// Returns the id of the Kapacitor task created for the j-th task of the test,
+// the first being the task of the test
+func (t *Test) chainedTaskId(j int) string {
+	if j == 0 {
+		return t.taskId()
+	}
+	return fmt.Sprintf("%v-%d", t.taskId(), j)
+}
+
+// Checks the multi-task configuration of the test
+func (t *Test) validateTasks() string {
+	if len(t.TaskNames) > 0 {
+		return "Configuration file cannot define task_names and tasks for the same test case"
+	}
+	if len(t.Tasks) == 0 {
+		return ""
+	}
+	for _, c := range t.Tasks {
+		if (c.TaskName == "") == (c.TemplateName == "") {
+			return "Configuration file must define either a task_name or a template_name for each of the tasks"
+		}
+		if len(c.Vars) > 0 && c.TemplateName == "" {
+			return "Configuration file cannot define vars without a template_name for a task"
+		}
+	}
+	first := t.Tasks[0]
+	if t.TaskName != first.TaskName || t.TemplateName != first.TemplateName {
+		return "Configuration file cannot define a task_name or template_name and tasks for the same test case"
+	}
+	return ""
+}
+
+// Fetches the alerts triggered by each task, and compares them with the
+// alerts expected from each task. If no task defines expected alerts, the
+// alerts triggered by all tasks are compared with the expected test result.
+// Tasks without alert nodes trigger no alerts.
+func (t *Test) chainedResults(k io.StatsReader) error {
+	total := Result{}
+	perTask := false
+	for j := range t.Tasks {
+		c := &t.Tasks[j]
+		s, err := k.NodeStats(t.chainedTaskId(j))
+		if err != nil {
+			return err
+		}
+		c.Result = NewResult(alertCounts(s))
+		total.Ok += c.Result.Ok
+		total.Warn += c.Result.Warn
+		total.Crit += c.Result.Crit
+		if c.Expects != nil {
+			perTask = true
+			c.Result.Compare(*c.Expects)
+		}
+	}
+
+	t.Result = total
+	if !perTask {
+		t.Result.Compare(t.Expects)
+		return nil
+	}
+	failures := []string{}
+	for _, c := range t.Tasks {
+		if c.Expects != nil && !c.Result.Passed {
+			failures = append(failures, "Task "+c.ScriptName()+": "+c.Result.Message)
+		}
+	}
+	if len(failures) == 0 {
+		t.Result.Passed = true
+		t.Result.Message = "OK"
+	} else {
+		t.Result.Message = strings.Join(failures, "")
+	}
+	return nil
+}
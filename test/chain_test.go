@@ -0,0 +1,137 @@
+package test
+
+import (
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/task"
+	"gopkg.in/h2non/gock.v1"
+	"strings"
+	"testing"
+)
+
+func TestExpandTaskNames(t *testing.T) {
+	tst := Test{TaskNames: []string{"derive.tick", "alert.tick"}}
+	tst.ExpandTasks()
+	if len(tst.Tasks) != 2 || tst.Tasks[1].TaskName != "alert.tick" {
+		t.Error("Task names should be expanded into tasks: ", tst.Tasks)
+	}
+	if tst.TaskName != "derive.tick" {
+		t.Error("First task should be the task of the test, got ", tst.TaskName)
+	}
+	tst.Validate()
+	if tst.Result.Error {
+		t.Error("Test should be valid: ", tst.Result.Message)
+	}
+	exp := []string{"derive.tick", "alert.tick"}
+	if strings.Join(tst.ScriptNames(), ",") != strings.Join(exp, ",") {
+		t.Error("Script names should be ", exp, " got ", tst.ScriptNames())
+	}
+}
+
+func TestExpandTasksTemplate(t *testing.T) {
+	vars := map[string]Var{"crit": {Type: "float", Value: 80}}
+	tst := Test{Tasks: []ChainedTask{{TemplateName: "derive.tick", Vars: vars}, {TaskName: "alert.tick"}}}
+	tst.ExpandTasks()
+	if tst.TemplateName != "derive.tick" || tst.Vars["crit"].Value != 80 {
+		t.Error("First task should be the template and vars of the test")
+	}
+}
+
+func TestValidateTasks(t *testing.T) {
+	invalid := []Test{
+		{TaskName: "a.tick", Tasks: []ChainedTask{{TaskName: "b.tick"}, {TaskName: "c.tick"}}},
+		{TaskNames: []string{"a.tick"}, Tasks: []ChainedTask{{TaskName: "b.tick"}}},
+		{Tasks: []ChainedTask{{TaskName: "a.tick"}, {TaskName: "b.tick", TemplateName: "c.tick"}}},
+		{Tasks: []ChainedTask{{TaskName: "a.tick"}, {TaskName: "b.tick", Vars: map[string]Var{"x": {}}}}},
+	}
+	for _, tst := range invalid {
+		tst.ExpandTasks()
+		tst.Validate()
+		if !tst.Result.Error {
+			t.Error("Test tasks should be invalid: ", tst.Tasks)
+		}
+	}
+}
+
+func TestDryRunChained(t *testing.T) {
+	tst := Test{
+		Id:    "kapacitor-unit-0",
+		Type:  "stream",
+		Tasks: []ChainedTask{{TaskName: "derive.tick"}, {TemplateName: "alert.tick"}},
+	}
+	tst.ExpandTasks()
+	tst.Task = task.Task{Script: "stream"}
+	tst.Tasks[1].Task = task.Task{Script: "dbrp \"derived\".\"autogen\"\nstream"}
+	defs, err := tst.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 3 {
+		t.Fatal("Dry run should print the task, and the template and task of the alert, got ", defs)
+	}
+	if !strings.Contains(defs[0], `"id":"kapacitor-unit-0"`) || !strings.Contains(defs[2], `"template-id":"kapacitor-unit-0-1"`) {
+		t.Error("Unexpected definitions: ", defs)
+	}
+}
+
+func TestChainedResults(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := io.NewKapacitor(h)
+
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/kapacitor-unit-0").
+		Reply(200).
+		JSON([]byte(`{"stats": {"node-stats": {"stream0": {"collected": 3}}}}`))
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/kapacitor-unit-0-1").
+		Reply(200).
+		JSON([]byte(`{"stats": {"node-stats": {"alert2": {"crits_triggered": 1, "warns_triggered": 0, "oks_triggered": 1}}}}`))
+
+	tst := Test{
+		Id:      "kapacitor-unit-0",
+		Tasks:   []ChainedTask{{TaskName: "derive.tick"}, {TaskName: "alert.tick"}},
+		Expects: Result{Ok: 1, Crit: 1},
+	}
+	tst.ExpandTasks()
+	err := tst.results(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tst.Result.Passed {
+		t.Error("Alerts of all tasks should match the test expects: ", tst.Result.Message)
+	}
+}
+
+func TestChainedResultsPerTask(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := io.NewKapacitor(h)
+
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/kapacitor-unit-0").
+		Reply(200).
+		JSON([]byte(`{"stats": {"node-stats": {"alert3": {"crits_triggered": 0, "warns_triggered": 1, "oks_triggered": 0}}}}`))
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/kapacitor-unit-0-1").
+		Reply(200).
+		JSON([]byte(`{"stats": {"node-stats": {"alert2": {"crits_triggered": 0, "warns_triggered": 0, "oks_triggered": 0}}}}`))
+
+	tst := Test{
+		Id: "kapacitor-unit-0",
+		Tasks: []ChainedTask{
+			{TaskName: "derive.tick", Expects: &Result{Warn: 1}},
+			{TaskName: "alert.tick", Expects: &Result{Crit: 1}},
+		},
+	}
+	tst.ExpandTasks()
+	err := tst.results(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tst.Result.Passed {
+		t.Error("Test should fail when a task does not trigger the expected alerts")
+	}
+	if !strings.HasPrefix(tst.Result.Message, "Task alert.tick: FAIL") || strings.Contains(tst.Result.Message, "derive.tick") {
+		t.Error("Failure should name the failing task: ", tst.Result.Message)
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adds timestamps to the data points without one, spread evenly and strictly
+// inside the interval (start, end)
+func timestampData(data []string, start time.Time, end time.Time) []string {
+	step := end.Sub(start) / time.Duration(len(data)+1)
+	r := make([]string, len(data))
+	for i, d := range data {
+		if hasTimestamp(d) {
+			r[i] = d
+			continue
+		}
+		ts := start.Add(step * time.Duration(i+1))
+		r[i] = strings.TrimRight(d, " ") + " " + strconv.FormatInt(ts.UnixNano(), 10)
+	}
+	return r
+}
+
+// Checks if a line protocol data point defines a timestamp
+func hasTimestamp(line string) bool {
+	return len(splitLine(line)) > 2
+}
+
+// Returns the timestamp of a line protocol data point, if it defines one
+func lineTimestamp(line string) (time.Time, bool) {
+	e := splitLine(line)
+	if len(e) < 3 {
+		return time.Time{}, false
+	}
+	ns, err := strconv.ParseInt(e[2], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// Returns the time range covered by the timestamps of the data points
+func dataTimeRange(data []string) (time.Time, time.Time) {
+	var start, end time.Time
+	for _, d := range data {
+		ts, ok := lineTimestamp(d)
+		if !ok {
+			continue
+		}
+		if start.IsZero() || ts.Before(start) {
+			start = ts
+		}
+		if end.IsZero() || ts.After(end) {
+			end = ts
+		}
+	}
+	return start, end
+}
+
+// Splits a line protocol data point in its space separated elements, i.e.
+// measurement and tags, fields and timestamp. Escaped spaces and spaces inside
+// quoted field values are not separators.
+func splitLine(line string) []string {
+	e := []string{}
+	var cur strings.Builder
+	quoted, escaped := false, false
+	for _, c := range strings.TrimSpace(line) {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ' ' && !quoted:
+			if cur.Len() > 0 {
+				e = append(e, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(c)
+	}
+	if cur.Len() > 0 {
+		e = append(e, cur.String())
+	}
+	return e
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasTimestamp(t *testing.T) {
+	cases := map[string]bool{
+		"cpu value=1":                                  false,
+		"cpu value=1 1514800000000000000":              true,
+		"cpu,host=a value=1,b=2 1514800000000000000":   true,
+		`cpu,host=a\ b value=1`:                        false,
+		`cpu,host=a msg="some text with spaces"`:       false,
+		`cpu,host=a msg="escaped \" quote" 1514800000`: true,
+		" cpu value=1 ":                                false,
+	}
+	for l, exp := range cases {
+		if hasTimestamp(l) != exp {
+			t.Error("hasTimestamp(", l, ") should be ", exp)
+		}
+	}
+}
+
+func TestTimestampData(t *testing.T) {
+	start := time.Unix(100, 0)
+	end := time.Unix(103, 0)
+	d := []string{"cpu value=1", "cpu value=2 50000000000"}
+
+	r := timestampData(d, start, end)
+
+	if r[0] != "cpu value=1 101000000000" {
+		t.Error("Timestamp not added as expected: ", r[0])
+	}
+	if r[1] != d[1] {
+		t.Error("Data point with timestamp should not change: ", r[1])
+	}
+}
+
+func TestDataTimeRange(t *testing.T) {
+	d := []string{
+		"cpu value=1 300",
+		"cpu value=2",
+		"cpu value=3 100",
+		"cpu value=4 200",
+	}
+	start, end := dataTimeRange(d)
+	if start.UnixNano() != 100 || end.UnixNano() != 300 {
+		t.Error("Time range should be [100, 300], got ", start.UnixNano(), end.UnixNano())
+	}
+}
@@ -0,0 +1,235 @@
+package test
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/io/kapacitortest"
+	"github.com/gpestana/kapacitor-unit/task"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Starts a fake Kapacitor and InfluxDB server and returns its clients
+func newFake() (*kapacitortest.Server, io.Kapacitor, io.Influxdb) {
+	s := kapacitortest.NewServer()
+	return s, io.NewKapacitor(s.URL), io.NewInfluxdb(s.URL)
+}
+
+// Returns the paths of the DELETE requests received by the fake server
+func deleted(s *kapacitortest.Server) []string {
+	d := []string{}
+	for _, r := range s.Requests() {
+		if r.Method == "DELETE" {
+			d = append(d, r.Path)
+		}
+	}
+	return d
+}
+
+// Node stats of tasks triggering a critical alert for each point with value=99
+func critOn99(id string, points []string) map[string]map[string]int {
+	crits := 0
+	for _, p := range points {
+		if strings.Contains(p, "value=99") {
+			crits++
+		}
+	}
+	return map[string]map[string]int{"alert2": {"crits_triggered": crits}}
+}
+
+// Node stats of the given task, which triggers a critical alert
+func critOn(task string) kapacitortest.NodeStatsFunc {
+	return func(id string, points []string) map[string]map[string]int {
+		if id != task {
+			return nil
+		}
+		return map[string]map[string]int{"alert2": {"crits_triggered": 1}}
+	}
+}
+
+// Node stats of tasks triggering a critical alert for each gap of more than 5m
+// in the data time between the points of the cpu measurement and the next
+// point
+func gaps(id string, points []string) map[string]map[string]int {
+	crits := 0
+	var last int64
+	for _, p := range points {
+		f := strings.Fields(p)
+		ts, _ := strconv.ParseInt(f[len(f)-1], 10, 64)
+		if last != 0 && time.Duration(ts-last) > 5*time.Minute {
+			crits++
+		}
+		if strings.HasPrefix(p, "cpu ") {
+			last = ts
+		}
+	}
+	return map[string]map[string]int{"alert3": {"crits_triggered": crits}}
+}
+
+func TestRunFake(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats kapacitortest.NodeStatsFunc
+		// Changes to the stream test expecting one critical alert
+		test func(tst *Test)
+		// Checks the fake server after the test passed
+		check func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test)
+	}{
+		{
+			name:  "stream",
+			stats: critOn99,
+			check: func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test) {
+				for _, r := range s.Requests() {
+					if r.Path == "/write" {
+						t.Error("Stream data should be written to Kapacitor only")
+					}
+				}
+				if len(s.Tasks()) != 0 || !reflect.DeepEqual(deleted(s), []string{"/kapacitor/v1/tasks/kapacitor-unit-0"}) {
+					t.Error("Task should be deleted after the test: ", deleted(s))
+				}
+			},
+		},
+		{
+			name:  "batch",
+			stats: critOn99,
+			test: func(tst *Test) {
+				tst.Type = "batch"
+				tst.Data = []string{"cpu value=99"}
+				tst.Task.Script = "batch\n|query('SELECT * FROM weather.autogen.cpu')\n.period(5m)\n.every(5m)"
+			},
+			check: func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test) {
+				if len(s.Databases()) != 0 {
+					t.Error("Database should be deleted after the test: ", s.Databases())
+				}
+			},
+		},
+		{
+			// The recorded data must only reach the task through the replay,
+			// whose alerts are not counted in the stats of the loaded task
+			name:  "replay",
+			stats: critOn99,
+			test: func(tst *Test) {
+				tst.Clock = "fast"
+				tst.Data = []string{"cpu value=1 1000000000", "cpu value=99 2000000000"}
+				tst.KeepArtifacts = true
+			},
+			check: func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test) {
+				if len(s.Points(tst.Id)) != 0 {
+					t.Error("Recorded data should not reach the task through the InfluxDB subscription: ", s.Points(tst.Id))
+				}
+			},
+		},
+		{
+			// The replay sees the silence, not the loaded task
+			name:  "silence",
+			stats: gaps,
+			test: func(tst *Test) {
+				tst.Data = []string{"cpu value=1", "cpu value=2"}
+				tst.Silence = "10m"
+				tst.KeepArtifacts = true
+			},
+			check: func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test) {
+				replay, err := k.ReplayStats(tst.replayId())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				live, err := k.NodeStats(tst.Id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if replay["alert3"]["crits_triggered"] != 1 || live["alert3"]["crits_triggered"] != 0 {
+					t.Error("Gap should only be seen by the replay, got replay ", replay, " and task ", live)
+				}
+			},
+		},
+		{
+			name:  "chained",
+			stats: critOn("kapacitor-unit-0-1"),
+			test: func(tst *Test) {
+				tst.Tasks = []ChainedTask{{TaskName: "derive.tick"}, {TemplateName: "alert.tick", Expects: &Result{Crit: 1}}}
+				tst.Timeout = "1s"
+				tst.ExpandTasks()
+			},
+			check: func(t *testing.T, s *kapacitortest.Server, k io.Kapacitor, tst *Test) {
+				exp := []string{
+					"/kapacitor/v1/tasks/kapacitor-unit-0",
+					"/kapacitor/v1/tasks/kapacitor-unit-0-1",
+					"/kapacitor/v1/templates/kapacitor-unit-0-1",
+				}
+				if !reflect.DeepEqual(deleted(s), exp) {
+					t.Error("Tasks and templates should be deleted after the test, got ", deleted(s))
+				}
+			},
+		},
+	}
+	for _, c := range cases {
+		s, k, i := newFake()
+		s.SetNodeStatsFunc(c.stats)
+		tst := Test{
+			Name:     c.name,
+			Id:       "kapacitor-unit-0",
+			TaskName: "alert.tick",
+			Type:     "stream",
+			Db:       "weather",
+			Rp:       "autogen",
+			Data:     []string{"cpu value=1", "cpu value=99"},
+			Expects:  Result{Crit: 1},
+			Task:     task.Task{Script: "stream"},
+		}
+		if c.test != nil {
+			c.test(&tst)
+		}
+		err := tst.Run(k, i)
+		if err != nil {
+			t.Error(c.name, ": ", err)
+		} else if !tst.Result.Passed {
+			t.Error(c.name, ": test should pass: ", tst.Result)
+		} else {
+			c.check(t, s, k, &tst)
+		}
+		s.Close()
+	}
+}
+
+func TestRunIsolatedFake(t *testing.T) {
+	s, k, i := newFake()
+	defer s.Close()
+	s.SetNodeStatsFunc(critOn99)
+
+	tests := []Test{
+		{Name: "crit", Id: "ku-0", TaskName: "a.tick", Type: "stream", Db: "weather", Rp: "autogen", Data: []string{"cpu value=99"},
+			Expects: Result{Crit: 1}, Task: task.Task{Script: "dbrp \"weather\".\"autogen\"\n\nstream"}},
+		{Name: "ok", Id: "ku-1", TaskName: "a.tick", Type: "stream", Db: "weather", Rp: "autogen", Data: []string{"cpu value=1"},
+			Expects: Result{Crit: 0}, Task: task.Task{Script: "dbrp \"weather\".\"autogen\"\n\nstream"}},
+	}
+	for j := range tests {
+		tests[j].Isolate(fmt.Sprintf("ku%d", j))
+		if err := tests[j].setup(k, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for j := range tests {
+		tst := &tests[j]
+		if err := tst.addData(k, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for j := range tests {
+		tst := &tests[j]
+		if err := tst.wait(k); err != nil {
+			t.Fatal(err)
+		}
+		if err := tst.results(k); err != nil {
+			t.Fatal(err)
+		}
+		if !tst.Result.Passed {
+			t.Error("Isolated test should only see its own data: ", tst.Name, tst.Result)
+		}
+		tst.Teardown(k, i)
+	}
+}
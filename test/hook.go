@@ -0,0 +1,77 @@
+package test
+
+import (
+	"errors"
+	"github.com/gpestana/kapacitor-unit/io"
+	"strings"
+)
+
+// Hooks defined in a test configuration file. The before_all and after_all
+// hooks run once for all the tests of the file, while before_each and
+// after_each hooks run for each of them.
+type Hooks struct {
+	BeforeAll  []Hook `yaml:"before_all"`
+	AfterAll   []Hook `yaml:"after_all"`
+	BeforeEach []Hook `yaml:"before_each"`
+	AfterEach  []Hook `yaml:"after_each"`
+}
+
+// Runs either a shell command or an HTTP request
+type Hook struct {
+	Command string
+	Http    *HttpHook
+}
+
+// HTTP request run by a hook. The method defaults to GET, or POST if the
+// request has a body.
+type HttpHook struct {
+	Method  string
+	Url     string
+	Body    string
+	Headers map[string]string
+}
+
+// Runs the hook
+func (h Hook) Run() error {
+	switch {
+	case h.Command != "" && h.Http != nil:
+		return errors.New("hook cannot define both a command and an http request")
+	case h.Command != "":
+		return io.Command(h.Command)
+	case h.Http != nil:
+		m := h.Http.Method
+		if m == "" && h.Http.Body != "" {
+			m = "POST"
+		} else if m == "" {
+			m = "GET"
+		}
+		return io.Request(m, h.Http.Url, h.Http.Body, h.Http.Headers)
+	}
+	return errors.New("hook must define either a command or an http request")
+}
+
+// Runs hooks in order, stopping at the first one that fails
+func RunHooks(hooks []Hook) error {
+	for _, h := range hooks {
+		if err := h.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs all the hooks in order, even if some of them fail, as after hooks
+// clean up what the tests and previous hooks created. Returns the errors of
+// all the failed hooks.
+func RunAllHooks(hooks []Hook) error {
+	msgs := []string{}
+	for _, h := range hooks {
+		if err := h.Run(); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
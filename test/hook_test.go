@@ -0,0 +1,73 @@
+package test
+
+import (
+	"github.com/gpestana/kapacitor-unit/io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHookInvalid(t *testing.T) {
+	if err := (Hook{}).Run(); err == nil {
+		t.Error("Hook without command nor http request should return error")
+	}
+
+	h := Hook{Command: "true", Http: &HttpHook{Url: "http://stub:8080"}}
+	if err := h.Run(); err == nil {
+		t.Error("Hook with command and http request should return error")
+	}
+}
+
+func TestRunHooksStopsOnError(t *testing.T) {
+	hooks := []Hook{
+		{Command: "true"},
+		{Command: "false"},
+		{Command: "exit 1"},
+	}
+	err := RunHooks(hooks)
+	if err == nil || !strings.HasPrefix(err.Error(), "command 'false' ") {
+		t.Error("RunHooks should return the error of the first failed hook, got ", err)
+	}
+}
+
+func TestRunAllHooks(t *testing.T) {
+	f, err := ioutil.TempFile("", "hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	hooks := []Hook{
+		{Command: "false"},
+		{Command: "exit 2"},
+		{Command: "echo ran >> " + f.Name()},
+	}
+	err = RunAllHooks(hooks)
+	if err == nil || !strings.HasPrefix(err.Error(), "command 'false' ") || !strings.Contains(err.Error(), "command 'exit 2' ") {
+		t.Error("RunAllHooks should return the errors of all failed hooks, got ", err)
+	}
+	b, _ := ioutil.ReadFile(f.Name())
+	if string(b) != "ran\n" {
+		t.Error("RunAllHooks should run the hooks after a failed one")
+	}
+}
+
+func TestRunBeforeEachFails(t *testing.T) {
+	tst := Test{
+		Name:     "test",
+		TaskName: "a.tick",
+		Hooks: &Hooks{
+			BeforeEach: []Hook{{Command: "false"}},
+			AfterEach:  []Hook{{Command: "true"}},
+		},
+		KeepArtifacts: true,
+	}
+	var k io.Kapacitor
+	var i io.Influxdb
+
+	err := tst.Run(k, i)
+	if err == nil || !strings.HasPrefix(err.Error(), "before_each hook") {
+		t.Error("Run should return the before_each hook error, got ", err)
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// dbrp "db"."rp"
+	dbrpRegexp = regexp.MustCompile(`(?m)^(dbrp\s+")([^"]+)("\.)`)
+	// .database('db'), in from() and influxDBOut() nodes
+	databaseRegexp = regexp.MustCompile(`(\.database\(\s*')([^']+)(')`)
+	// FROM "db"."rp"."measurement" and FROM "db".."measurement" in queries
+	queryRegexp = regexp.MustCompile(`((?i:FROM)\s+)("[^"]+"|\w+)(\.("[^"]+"|\w+)?\.)`)
+)
+
+// Isolates the test data from other tests running at the same time, by
+// namespacing its database. Every database referenced in the TICKscript (dbrp,
+// .database() and batch queries) is renamed to <database>_<suffix>. Tests
+// replaying an existing recording are not isolated, since the recording holds
+// the data of the original database and retention policy.
+func (t *Test) Isolate(suffix string) {
+	if t.RecId != "" {
+		return
+	}
+	ns := func(db string) string {
+		return db + "_" + suffix
+	}
+	if t.Db != "" {
+		t.Db = ns(t.Db)
+	}
+	t.Task.Script = namespaceScript(t.Task.Script, ns)
+	for j := range t.Tasks {
+		t.Tasks[j].Task.Script = namespaceScript(t.Tasks[j].Task.Script, ns)
+	}
+}
+
+// Renames all databases referenced in a TICKscript
+func namespaceScript(s string, ns func(string) string) string {
+	s = dbrpRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		p := dbrpRegexp.FindStringSubmatch(m)
+		return p[1] + ns(p[2]) + p[3]
+	})
+	s = databaseRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		p := databaseRegexp.FindStringSubmatch(m)
+		return p[1] + ns(p[2]) + p[3]
+	})
+	s = queryRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		p := queryRegexp.FindStringSubmatch(m)
+		db := p[2]
+		if strings.HasPrefix(db, `"`) {
+			db = `"` + ns(strings.Trim(db, `"`)) + `"`
+		} else {
+			db = ns(db)
+		}
+		return p[1] + db + p[3]
+	})
+	return s
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"github.com/gpestana/kapacitor-unit/task"
+	"testing"
+)
+
+func TestIsolate(t *testing.T) {
+	s := `dbrp "weather"."default"
+
+var data = stream
+	| from()
+		.database('weather')
+		.retentionPolicy('default')
+		.measurement('temperature')
+
+var weather = batch
+	| query('''
+		SELECT mean(temperature)
+		FROM "weather"."default"."temperature"
+		''')
+		.period(5m)
+
+var rain = batch
+	| query('SELECT count(rain) FROM weather.."rain"')
+		.period(5m)
+
+var snow = batch
+	| query('SELECT count(snow) FROM "default"."snow"')
+		.period(5m)
+
+data
+	| influxDBOut()
+		.database('derived')
+`
+	exp := `dbrp "weather_ku1"."default"
+
+var data = stream
+	| from()
+		.database('weather_ku1')
+		.retentionPolicy('default')
+		.measurement('temperature')
+
+var weather = batch
+	| query('''
+		SELECT mean(temperature)
+		FROM "weather_ku1"."default"."temperature"
+		''')
+		.period(5m)
+
+var rain = batch
+	| query('SELECT count(rain) FROM weather_ku1.."rain"')
+		.period(5m)
+
+var snow = batch
+	| query('SELECT count(snow) FROM "default"."snow"')
+		.period(5m)
+
+data
+	| influxDBOut()
+		.database('derived_ku1')
+`
+	tst := Test{TaskName: "alert.tick", Db: "weather", Task: task.Task{Script: s}}
+
+	tst.Isolate("ku1")
+
+	if tst.Task.Script != exp {
+		t.Error("Script not namespaced as expected:\n", tst.Task.Script)
+	}
+	if tst.Db != "weather_ku1" {
+		t.Error("Database should be weather_ku1, got ", tst.Db)
+	}
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/gpestana/kapacitor-unit/io"
+	"regexp"
+	"time"
+)
+
+// Interval between the synthetic timestamps of the stream data points
+// without one, when the data is replayed
+const replayInterval = time.Second
+
+// Measurement of the data point written at the end of a test silence. It
+// advances the data time of the replay past the gap.
+const silenceMeasurement = "kapacitor_unit_silence"
+
+// deadman() and stats() nodes emit on the wall clock, independently of the
+// time of the data points, so they never fire in a replay that finishes in
+// milliseconds
+var wallClockRegexp = regexp.MustCompile(`\|\s*(deadman|stats)\s*\(`)
+
+// Checks if the test data is replayed against the task from a Kapacitor
+// recording instead of being written to Kapacitor in real time
+func (t *Test) replayed() bool {
+	return t.Clock == "fast" || t.RecId != "" || t.Silence != ""
+}
+
+// Checks if the TICKscript of the test has nodes that emit on the wall clock
+func (t *Test) usesWallClock() bool {
+	return wallClockRegexp.MatchString(t.Task.Script)
+}
+
+// Checks if the test needs a database in InfluxDB, either to be queried by a
+// batch task or to record stream data from
+func (t *Test) usesInfluxdb() bool {
+	return t.Type == "batch" || (t.replayed() && t.RecId == "")
+}
+
+// Writes the test data to InfluxDB and creates a Kapacitor recording with it.
+// Data points without timestamp are given synthetic timestamps, one
+// replayInterval apart and ending at the current time.
+func (t *Test) record(k io.Replayer, i io.DataWriter) error {
+	if t.RecId != "" {
+		return nil
+	}
+	if len(t.Data) == 0 {
+		return errors.New("test " + t.Name + " has no data to record")
+	}
+	now := time.Now()
+	start := now.Add(-replayInterval * time.Duration(len(t.Data)+1))
+	data := timestampData(t.Data, start, now)
+	if t.Silence != "" {
+		d, err := parseDuration(t.Silence)
+		if err != nil {
+			return err
+		}
+		data = appendSilence(data, d)
+	}
+
+	err := i.Data(data, t.Db, t.Rp)
+	if err != nil {
+		return err
+	}
+
+	// InfluxDB setup creates the "autogen" retention policy if none is defined
+	rp := t.Rp
+	if rp == "" {
+		rp = "autogen"
+	}
+	from, to := dataTimeRange(data)
+	q := fmt.Sprintf(`SELECT * FROM "%v"."%v"./.*/ WHERE time >= %d AND time <= %d GROUP BY *`,
+		t.Db, rp, from.UnixNano(), to.UnixNano())
+	return k.RecordQuery(t.recordingId(), t.Type, q)
+}
+
+// Appends to the data a point of the silence measurement, timestamped the
+// given duration after the last data point
+func appendSilence(data []string, d time.Duration) []string {
+	_, last := dataTimeRange(data)
+	p := fmt.Sprintf("%v value=1 %d", silenceMeasurement, last.Add(d).UnixNano())
+	return append(data, p)
+}
+
+// Replays the test recording against the task
+func (t *Test) replay(k io.Replayer) error {
+	clock := t.Clock
+	if clock == "" {
+		clock = "fast"
+	}
+	glog.Info("DEBUG:: replay test: ", t.Name, " with clock ", clock)
+	return k.Replay(t.replayId(), t.taskId(), t.recordingId(), clock)
+}
+
+// Fetches the alerts triggered by the replay and saves them. The replay runs
+// the task apart from the task loaded in Kapacitor, so its alerts are only
+// counted in the replay stats.
+func (t *Test) replayResults(k io.Replayer) error {
+	s, err := k.ReplayStats(t.replayId())
+	if err != nil {
+		return err
+	}
+	t.Result = NewResult(alertCounts(s))
+	t.Result.Compare(t.Expects)
+	return nil
+}
+
+// Deletes the replay and the recording created to run the test. Recordings
+// defined in the test configuration are kept.
+func (t *Test) deleteReplay(k io.Replayer) error {
+	err := k.DeleteReplay(t.replayId())
+	if err != nil {
+		return err
+	}
+	if t.RecId == "" {
+		return k.DeleteRecording(t.recordingId())
+	}
+	return nil
+}
+
+// Returns the id of the recording replayed in the test
+func (t *Test) recordingId() string {
+	if t.RecId != "" {
+		return t.RecId
+	}
+	return t.taskId() + "-recording"
+}
+
+// Returns the id of the replay created for the test
+func (t *Test) replayId() string {
+	return t.taskId() + "-replay"
+}
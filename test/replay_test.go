@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppendSilence(t *testing.T) {
+	d := []string{"cpu value=1 1000000000", "cpu value=2 2000000000"}
+
+	r := appendSilence(d, 10*time.Minute)
+
+	if len(r) != 3 {
+		t.Fatal("Silence data point not appended: ", r)
+	}
+	exp := "kapacitor_unit_silence value=1 602000000000"
+	if r[2] != exp {
+		t.Error("Silence data point should be ", exp, " got ", r[2])
+	}
+}
+
+func TestReplayIds(t *testing.T) {
+	tst := Test{TaskName: "deadman.tick", Clock: "fast"}
+	if tst.recordingId() != "deadman.tick-recording" || tst.replayId() != "deadman.tick-replay" {
+		t.Error("Unexpected recording and replay ids: ", tst.recordingId(), tst.replayId())
+	}
+
+	tst.RecId = "7c581a06-769d-45cb-97fe-a3c4d7ba061a"
+	if tst.recordingId() != tst.RecId {
+		t.Error("Recording id should be the test recording_id, got ", tst.recordingId())
+	}
+	if tst.usesInfluxdb() {
+		t.Error("Test replaying an existing recording should not use InfluxDB")
+	}
+}
+
+func TestReplayedTaskDisabled(t *testing.T) {
+	tst := Test{TaskName: "alert.tick", Type: "stream", Clock: "fast"}
+	if tst.definitions()[0].task["status"] != "disabled" {
+		t.Error("Task of a replayed test should be disabled: ", tst.definitions()[0].task)
+	}
+	tst.Clock = ""
+	if tst.definitions()[0].task["status"] != "enabled" {
+		t.Error("Task of a test writing to Kapacitor should be enabled: ", tst.definitions()[0].task)
+	}
+}
+
+func TestValidateReplayedChained(t *testing.T) {
+	tst := Test{Type: "stream", Clock: "fast",
+		Tasks: []ChainedTask{{TaskName: "a.tick"}, {TaskName: "b.tick"}}}
+	tst.ExpandTasks()
+	tst.Validate()
+	if !tst.Result.Error {
+		t.Error("Replayed test with several tasks should be invalid")
+	}
+}
@@ -12,6 +12,10 @@ type Result struct {
 	Message string
 	Passed  bool
 	Error   bool
+	Timeout bool
+	Skipped bool
+	// Passed after failing, when the test is retried
+	Flaky bool
 }
 
 func NewResult(r map[string]int) Result {
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/io"
+	"strings"
+)
+
+// Step of a test scenario. The step data is written to the task after the
+// data of the previous steps was processed, and the alerts triggered since
+// the previous step are compared with the step expects.
+type Step struct {
+	Name    string
+	Data    []string
+	Expects Result
+	Result  Result `yaml:"-"`
+}
+
+// Returns the name of the j-th step, used to report its failures
+func (s Step) label(j int) string {
+	if s.Name != "" {
+		return fmt.Sprintf("Step %d (%v)", j+1, s.Name)
+	}
+	return fmt.Sprintf("Step %d", j+1)
+}
+
+// Checks the steps configuration of the test
+func (t *Test) validateSteps() string {
+	if len(t.Steps) == 0 {
+		return ""
+	}
+	if len(t.Data) > 0 || t.RecId != "" {
+		return "Configuration file cannot define steps and data or recording_id for the same test case"
+	}
+	if t.Type != "stream" || t.replayed() {
+		return "Configuration file can only define steps for stream test cases with real clock"
+	}
+	return ""
+}
+
+// Runs the steps of the test in order. Each step writes its data, waits for
+// the task to process it and compares the alerts triggered during the step
+// with the step expects. A step that times out ends the test.
+func (t *Test) runSteps(k io.TaskBackend) error {
+	prev := map[string]int{}
+	points := 0
+	failures := []string{}
+	total := Result{}
+	for j := range t.Steps {
+		s := &t.Steps[j]
+		err := k.Data(s.Data, t.Db, t.Rp)
+		if err != nil {
+			return fmt.Errorf("%v: %v", s.label(j), err)
+		}
+		points += len(s.Data)
+		err = t.waitFor(k, points)
+		if err == errTimeout {
+			t.Result = Result{Message: s.label(j) + ": " + timeoutMessage(t), Timeout: true}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", s.label(j), err)
+		}
+
+		stats, err := t.nodeStats(k)
+		if err != nil {
+			return fmt.Errorf("%v: %v", s.label(j), err)
+		}
+		cur := alertCounts(stats)
+		delta := map[string]int{}
+		for key, v := range cur {
+			delta[key] = v - prev[key]
+		}
+		prev = cur
+
+		s.Result = NewResult(delta)
+		s.Result.Compare(s.Expects)
+		total.Ok += s.Result.Ok
+		total.Warn += s.Result.Warn
+		total.Crit += s.Result.Crit
+		if !s.Result.Passed {
+			failures = append(failures, s.label(j)+": "+s.Result.Message)
+		}
+	}
+
+	t.Result = total
+	if len(failures) == 0 {
+		t.Result.Passed = true
+		t.Result.Message = "OK"
+	} else {
+		t.Result.Message = strings.Join(failures, "")
+	}
+	return nil
+}
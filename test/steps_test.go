@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Kapacitor task that triggers a critical alert for points with value=99 and
+// an ok alert for the next point
+func alertingKapacitor() *httptest.Server {
+	var mu sync.Mutex
+	collected, crits, oks := 0, 0, 0
+	critical := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/kapacitor/v1/write":
+			b, _ := ioutil.ReadAll(r.Body)
+			collected++
+			if strings.HasSuffix(string(b), "value=99") {
+				crits++
+				critical = true
+			} else if critical {
+				oks++
+				critical = false
+			}
+			w.WriteHeader(204)
+		case r.Method == "GET":
+			fmt.Fprintf(w, `{"stats": {"node-stats": {"stream0": {"collected": %d}, `+
+				`"alert2": {"crits_triggered": %d, "warns_triggered": 0, "oks_triggered": %d}}}}`,
+				collected, crits, oks)
+		}
+	}))
+}
+
+func TestRunSteps(t *testing.T) {
+	s := alertingKapacitor()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+
+	tst := Test{
+		Id:   "kapacitor-unit-0",
+		Type: "stream",
+		Steps: []Step{
+			{Name: "normal", Data: []string{"cpu value=1", "cpu value=2"}},
+			{Name: "spike", Data: []string{"cpu value=99"}, Expects: Result{Crit: 1}},
+			{Name: "recovery", Data: []string{"cpu value=3"}, Expects: Result{Ok: 1}},
+		},
+	}
+	err := tst.runSteps(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tst.Result.Passed {
+		t.Error("Steps should pass: ", tst.Result.Message)
+	}
+	if tst.Result.Crit != 1 || tst.Result.Ok != 1 {
+		t.Error("Test result should sum the alerts of all steps: ", tst.Result)
+	}
+}
+
+func TestRunStepsFailure(t *testing.T) {
+	s := alertingKapacitor()
+	defer s.Close()
+	k := io.NewKapacitor(s.URL)
+
+	tst := Test{
+		Id:   "kapacitor-unit-0",
+		Type: "stream",
+		Steps: []Step{
+			{Data: []string{"cpu value=99"}, Expects: Result{Crit: 1}},
+			{Name: "recovery", Data: []string{"cpu value=99"}, Expects: Result{Ok: 1}},
+		},
+	}
+	err := tst.runSteps(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tst.Result.Passed {
+		t.Error("Steps should fail when a step does not trigger the expected alerts")
+	}
+	if !strings.HasPrefix(tst.Result.Message, "Step 2 (recovery): FAIL") {
+		t.Error("Failure should name the failing step: ", tst.Result.Message)
+	}
+}
+
+func TestValidateSteps(t *testing.T) {
+	steps := []Step{{Data: []string{"cpu value=1"}}}
+	invalid := []Test{
+		{TaskName: "a.tick", Type: "stream", Steps: steps, Data: []string{"cpu value=1"}},
+		{TaskName: "a.tick", Type: "batch", Steps: steps},
+		{TaskName: "a.tick", Type: "stream", Clock: "fast", Steps: steps},
+	}
+	for _, tst := range invalid {
+		tst.Validate()
+		if !tst.Result.Error {
+			t.Error("Test steps should be invalid: ", tst)
+		}
+	}
+	tst := Test{TaskName: "a.tick", Type: "stream", Steps: steps}
+	tst.Validate()
+	if tst.Result.Error {
+		t.Error("Test steps should be valid: ", tst.Result.Message)
+	}
+}
@@ -4,75 +4,181 @@
 package test
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/gpestana/kapacitor-unit/io"
 	"github.com/gpestana/kapacitor-unit/task"
-	"time"
 	"regexp"
+	"strings"
+	"time"
 )
 
 type Test struct {
-	Name     string
-	TaskName string `yaml:"task_name,omitempty"`
-	Data     []string
-	RecId    string `yaml:"recording_id"`
-	Expects  Result
-	Result   Result
-	Db       string
-	Rp       string
-	Type     string
-	Task     task.Task
+	Name         string
+	Tags         []string
+	Id           string `yaml:"-"`
+	TaskName     string `yaml:"task_name,omitempty"`
+	TemplateName string `yaml:"template_name,omitempty"`
+	Vars         map[string]Var
+	Data         []string
+	RecId        string `yaml:"recording_id"`
+	Expects      Result
+	Result       Result
+	Db           string
+	Rp           string
+	Type         string
+	Clock        string `yaml:"clock,omitempty"`
+	Silence      string `yaml:"silence,omitempty"`
+	Timeout      string `yaml:"timeout,omitempty"`
+	Task         task.Task
+	// Tasks of a test that loads several chained tasks. The test data is
+	// written to the first task.
+	TaskNames []string      `yaml:"task_names,omitempty"`
+	Tasks     []ChainedTask `yaml:"tasks,omitempty"`
+	// Steps of a test scenario, run in order against the same tasks
+	Steps []Step `yaml:"steps,omitempty"`
+	// Number of times the test is run again if it does not pass
+	Retries int `yaml:"retries,omitempty"`
+	// Leaves the task and database in place after running the test
+	KeepArtifacts bool `yaml:"-"`
+	// Configuration file where the test is defined, and its hooks
+	File  string `yaml:"-"`
+	Hooks *Hooks `yaml:"-"`
+	// Time the test took to run
+	Duration time.Duration `yaml:"-"`
+	// Results of each run of a test run several times (see --count)
+	Runs []Result `yaml:"-"`
+}
+
+// Template variable used to instantiate a task from a template, as defined in
+// the Kapacitor API (e.g. {"type": "float", "value": 80})
+type Var struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
 }
 
 func NewTest() Test {
 	return Test{}
 }
 
-// Method exposed to start the test. It sets up the test, adds the test data,
-// fetches the triggered alerts and saves it. It also removes all artifacts
-// (database, retention policy) created for the test.
-func (t *Test) Run(k io.Kapacitor, i io.Influxdb) error {
-	err := t.setup(k, i)
+// Method exposed to start the test. It runs the before_each hooks, sets up
+// the test, adds the test data, fetches the triggered alerts and saves it. It
+// also removes all artifacts (database, retention policy) created for the test
+// and runs the after_each hooks, even if the test fails or panics.
+func (t *Test) Run(k io.TaskBackend, i io.DataBackend) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("test panicked: %v", r)
+		}
+		terr := t.Teardown(k, i)
+		if err == nil {
+			err = terr
+		}
+		if t.Hooks != nil {
+			herr := RunAllHooks(t.Hooks.AfterEach)
+			if err == nil && herr != nil {
+				err = errors.New("after_each hook: " + herr.Error())
+			}
+		}
+	}()
+
+	if t.Hooks != nil {
+		err = RunHooks(t.Hooks.BeforeEach)
+		if err != nil {
+			return errors.New("before_each hook: " + err.Error())
+		}
+	}
+
+	err = t.setup(k, i)
 	if err != nil {
 		return err
 	}
+	if len(t.Steps) > 0 {
+		return t.runSteps(k)
+	}
 	err = t.addData(k, i)
 	if err != nil {
 		return err
 	}
-	t.wait()
-	err = t.results(k)
-	if err != nil {
-		return err
+	if t.replayed() {
+		err = t.replay(k)
+		if err != nil {
+			return err
+		}
+		return t.replayResults(k)
+	}
+	err = t.wait(k)
+	if err == errTimeout {
+		t.Result = Result{Message: timeoutMessage(t), Timeout: true}
+		return nil
 	}
-	err = t.teardown(k, i)
 	if err != nil {
 		return err
 	}
-	return nil
+	return t.results(k)
 }
 
 func (t Test) String() string {
+	if t.Result.Skipped == true {
+		return fmt.Sprintf("TEST %v (%v) SKIPPED: %v", t.Name, t.ScriptName(), t.Result.String())
+	}
+	if t.Result.Flaky == true {
+		return fmt.Sprintf("TEST %v (%v) FLAKY-PASSED: %v", t.Name, t.ScriptName(), t.Result.String())
+	}
+	if t.Result.Timeout == true {
+		return fmt.Sprintf("TEST %v (%v) TIMEOUT: %v", t.Name, t.ScriptName(), t.Result.String())
+	}
 	if t.Result.Error == true {
-		return fmt.Sprintf("TEST %v (%v) ERROR: %v", t.Name, t.TaskName, t.Result.String())
+		return fmt.Sprintf("TEST %v (%v) ERROR: %v", t.Name, t.ScriptName(), t.Result.String())
 	} else {
-		return fmt.Sprintf("TEST %v (%v) %v", t.Name, t.TaskName, t.Result.String())
+		return fmt.Sprintf("TEST %v (%v) %v", t.Name, t.ScriptName(), t.Result.String())
+	}
+}
+
+// Checks if the test has any of the given tags
+func (t Test) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		for _, tt := range t.Tags {
+			if tt == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the name of the TICKscript file under test, which is either the
+// task or the template file
+func (t Test) ScriptName() string {
+	if t.TemplateName != "" {
+		return t.TemplateName
 	}
+	return t.TaskName
 }
 
 // Adds test data
-func (t *Test) addData(k io.Kapacitor, i io.Influxdb) error {
+func (t *Test) addData(k io.TaskBackend, i io.DataBackend) error {
 	switch t.Type {
 	case "stream":
+		// records data to be replayed against the task
+		if t.replayed() {
+			return t.record(k, i)
+		}
 		// adds data to kapacitor
 		err := k.Data(t.Data, t.Db, t.Rp)
 		if err != nil {
 			return err
 		}
 	case "batch":
+		// places data inside the window read by the next batch query
+		w, err := parseBatchWindow(t.Task.Script)
+		if err != nil {
+			return err
+		}
+		data := w.timestamp(t.Data, time.Now())
 		// adds data to InfluxDb
-		err := i.Data(t.Data, t.Db, t.Rp)
+		err = i.Data(data, t.Db, t.Rp)
 		if err != nil {
 			return err
 		}
@@ -85,73 +191,237 @@ func (t *Test) Validate() error {
 	glog.Info("DEBUG:: validate test: ", t.Name)
 	if len(t.Data) > 0 && t.RecId != "" {
 		m := "Configuration file cannot define a recording_id and line protocol data input for the same test case"
-		r := Result{0, 0, 0, m, false, true}
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.TaskName != "" && t.TemplateName != "" {
+		m := "Configuration file cannot define a task_name and template_name for the same test case"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if len(t.Vars) > 0 && t.TemplateName == "" {
+		m := "Configuration file cannot define vars without a template_name"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if m := t.validateTasks(); m != "" {
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if m := t.validateSteps(); m != "" {
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.Clock != "" && t.Clock != "real" && t.Clock != "fast" {
+		m := "Configuration file clock must be either real or fast"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.Clock == "fast" && t.Type != "stream" {
+		m := "Configuration file can only define a fast clock for stream test cases"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.replayed() && t.chained() {
+		m := "Configuration file cannot define a fast clock, recording_id or silence for test cases with several tasks"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.replayed() && t.usesWallClock() {
+		m := "Configuration file cannot define a fast clock, recording_id or silence for test cases of TICKscripts with deadman() or stats() nodes"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.Retries < 0 {
+		m := "Configuration file retries cannot be negative"
+		r := Result{Message: m, Error: true}
 		t.Result = r
 	}
+	if _, err := t.timeout(); err != nil {
+		m := "Configuration file timeout must be a duration (e.g. 30s)"
+		r := Result{Message: m, Error: true}
+		t.Result = r
+	}
+	if t.Silence != "" {
+		_, err := parseDuration(t.Silence)
+		if t.Type != "stream" || t.RecId != "" || t.Clock == "real" || err != nil {
+			m := "Configuration file can only define a silence (e.g. 10m) for stream test cases with line protocol data input and fast clock"
+			r := Result{Message: m, Error: true}
+			t.Result = r
+		}
+	}
 	return nil
 }
 
 // Creates all necessary artifacts in database to run the test
-func (t *Test) setup(k io.Kapacitor, i io.Influxdb) error {
+func (t *Test) setup(k io.TaskBackend, i io.DataBackend) error {
 	glog.Info("DEBUG:: setup test: ", t.Name)
-	switch t.Type {
-	case "batch":
+	if t.usesInfluxdb() {
 		err := i.Setup(t.Db, t.Rp)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Loads test task to kapacitor
+	// Loads the test templates and tasks to kapacitor
+	for _, d := range t.definitions() {
+		if d.template != nil {
+			err := k.LoadTemplate(d.template)
+			if err != nil {
+				return err
+			}
+		}
+		err := k.Load(d.task)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Definitions of a Kapacitor task and of its template, if the task is based
+// on a template
+type definition struct {
+	template map[string]interface{}
+	task     map[string]interface{}
+}
+
+// Returns the definitions of the Kapacitor tasks and templates loaded to run
+// the test, starting with the task the test data is written to
+func (t *Test) definitions() []definition {
+	d := []definition{t.definition(t.taskId(), t.TemplateName, t.Vars, t.Task.Script)}
+	for j, c := range t.downstream() {
+		d = append(d, t.definition(t.chainedTaskId(j+1), c.TemplateName, c.Vars, c.Task.Script))
+	}
+	return d
+}
+
+func (t *Test) definition(id string, templateName string, vars map[string]Var, script string) definition {
+	dbrp, _ := regexp.MatchString(`(?m:^dbrp \"\w+\"\.\"\w+\"$)`, script)
+
+	// Replayed tests keep their task disabled, so that it only processes the
+	// replayed data, and not the data written to InfluxDB to record it, which
+	// reaches the enabled tasks through the InfluxDB subscriptions
+	status := "enabled"
+	if t.replayed() {
+		status = "disabled"
+	}
+
+	d := definition{}
 	f := map[string]interface{}{
-		"id":     t.TaskName,
-		"type":   t.Type,
-		"script": t.Task.Script,
-		"status": "enabled",
+		"id":     id,
+		"status": status,
+	}
+	if templateName != "" {
+		d.template = map[string]interface{}{
+			"id":     id,
+			"type":   t.Type,
+			"script": script,
+		}
+		f["template-id"] = id
+		f["vars"] = vars
+	} else {
+		f["type"] = t.Type
+		f["script"] = script
 	}
 
-	dbrp, _ := regexp.MatchString(`(?m:^dbrp \"\w+\"\.\"\w+\"$)`, t.Task.Script)
 	if !dbrp {
 		f["dbrps"] = []map[string]string{{"db": t.Db, "rp": t.Rp}}
 	}
+	d.task = f
+	return d
+}
 
-	err := k.Load(f)
-	if err != nil {
-		return err
+// Returns the JSON of the templates and tasks that would be sent to Kapacitor
+// to run the test
+func (t *Test) DryRun() ([]string, error) {
+	r := []string{}
+	for _, d := range t.definitions() {
+		for _, f := range []map[string]interface{}{d.template, d.task} {
+			if f == nil {
+				continue
+			}
+			j, err := io.EncodeTask(f)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, string(j))
+		}
 	}
-	return nil
+	return r, nil
 }
 
-func (t *Test) wait() {
-	switch t.Type {
-	case "batch":
-		// If batch script, waits 3 seconds for batch queries being processed
-		fmt.Println("Processing batch script " + t.TaskName + "...")
-		time.Sleep(3 * time.Second)
+// Returns the id of the Kapacitor task created for the test
+func (t *Test) taskId() string {
+	if t.Id != "" {
+		return t.Id
 	}
+	return t.ScriptName()
 }
 
-// Deletes data, database and retention policies created to run the test
-func (t *Test) teardown(k io.Kapacitor, i io.Influxdb) error {
+// Deletes data, database and retention policies created to run the test. All
+// artifacts are deleted even if some of the deletions fail, in which case the
+// first error is returned. If the test keeps its artifacts, they are printed
+// instead.
+func (t *Test) Teardown(k io.TaskBackend, i io.DataBackend) error {
+	if t.KeepArtifacts {
+		fmt.Println(t.artifacts())
+		return nil
+	}
 	glog.Info("DEBUG:: teardown test: ", t.Name)
-	switch t.Type {
-	case "batch":
-		err := i.CleanUp(t.Db)
+	var errs []error
+	if t.usesInfluxdb() {
+		errs = append(errs, i.CleanUp(t.Db, t.Rp))
+	}
+	if t.replayed() {
+		errs = append(errs, t.deleteReplay(k))
+	}
+	errs = append(errs, k.Delete(t.taskId()))
+	if t.TemplateName != "" {
+		errs = append(errs, k.DeleteTemplate(t.taskId()))
+	}
+	for j, c := range t.downstream() {
+		errs = append(errs, k.Delete(t.chainedTaskId(j+1)))
+		if c.TemplateName != "" {
+			errs = append(errs, k.DeleteTemplate(t.chainedTaskId(j+1)))
+		}
+	}
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
 	}
-	err := k.Delete(t.TaskName)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
+// Describes the artifacts created in Kapacitor and InfluxDB to run the test
+func (t *Test) artifacts() string {
+	a := []string{"task " + t.taskId()}
+	if t.TemplateName != "" {
+		a = append(a, "template "+t.taskId())
+	}
+	for j, c := range t.downstream() {
+		a = append(a, "task "+t.chainedTaskId(j+1))
+		if c.TemplateName != "" {
+			a = append(a, "template "+t.chainedTaskId(j+1))
+		}
+	}
+	if t.replayed() {
+		a = append(a, "recording "+t.recordingId(), "replay "+t.replayId())
+	}
+	if t.usesInfluxdb() {
+		a = append(a, "database "+t.Db)
+	}
+	return fmt.Sprintf("Kept artifacts of test %v: %v", t.Name, strings.Join(a, ", "))
+}
+
 // Fetches status of kapacitor task, stores it and compares expected test result
 // and actual result test
-func (t *Test) results(k io.Kapacitor) error {
-	s, err := k.Status(t.Task.Name)
+func (t *Test) results(k io.StatsReader) error {
+	if t.chained() {
+		return t.chainedResults(k)
+	}
+	s, err := k.Status(t.taskId())
 	if err != nil {
 		return err
 	}
@@ -1,7 +1,12 @@
 package test
 
 import (
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/task"
+	"gopkg.in/h2non/gock.v1"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateRecAndData(t *testing.T) {
@@ -62,3 +67,271 @@ func TestValidateRecNotOk(t *testing.T) {
 		t.Error("Test configuration with recording id and protocol line data is invalid")
 	}
 }
+
+func TestValidateTaskAndTemplate(t *testing.T) {
+	tst := NewTest()
+
+	tst.TaskName = "alert_weather.tick"
+	tst.TemplateName = "alert_weather_template.tick"
+
+	tst.Validate()
+
+	if tst.Result.Error != true {
+		t.Error("Test configuration with task_name and template_name is invalid")
+	}
+}
+
+func TestValidateVarsWithoutTemplate(t *testing.T) {
+	tst := NewTest()
+
+	tst.TaskName = "alert_weather.tick"
+	tst.Vars = map[string]Var{"warn": {"int", 60}}
+
+	tst.Validate()
+
+	if tst.Result.Error != true {
+		t.Error("Test configuration with vars and no template_name is invalid")
+	}
+}
+
+func TestScriptName(t *testing.T) {
+	tst := NewTest()
+	tst.TaskName = "alert_weather.tick"
+	if tst.ScriptName() != "alert_weather.tick" {
+		t.Error("Script name should be the task name, got ", tst.ScriptName())
+	}
+
+	tst = NewTest()
+	tst.TemplateName = "alert_weather_template.tick"
+	if tst.ScriptName() != "alert_weather_template.tick" {
+		t.Error("Script name should be the template name, got ", tst.ScriptName())
+	}
+}
+
+func TestValidateClock(t *testing.T) {
+	tst := NewTest()
+	tst.Type = "stream"
+	tst.Clock = "slow"
+
+	tst.Validate()
+
+	if tst.Result.Error != true {
+		t.Error("Test configuration with unknown clock is invalid")
+	}
+}
+
+func TestValidateFastClockBatch(t *testing.T) {
+	tst := NewTest()
+	tst.Type = "batch"
+	tst.Clock = "fast"
+
+	tst.Validate()
+
+	if tst.Result.Error != true {
+		t.Error("Test configuration with fast clock for batch script is invalid")
+	}
+}
+
+func TestValidateFastClockStream(t *testing.T) {
+	tst := NewTest()
+	tst.Type = "stream"
+	tst.Clock = "fast"
+
+	tst.Validate()
+
+	if tst.Result.Error != false {
+		t.Error("Test configuration with fast clock for stream script must be valid")
+	}
+}
+
+func TestValidateSilence(t *testing.T) {
+	tst := NewTest()
+	tst.Type = "stream"
+	tst.Data = []string{"data1"}
+	tst.Silence = "10m"
+
+	tst.Validate()
+
+	if tst.Result.Error != false {
+		t.Error("Test configuration with silence for stream script must be valid")
+	}
+	if !tst.replayed() {
+		t.Error("Test configuration with silence must be replayed")
+	}
+}
+
+func TestValidateSilenceNotOk(t *testing.T) {
+	invalid := []Test{
+		{Type: "batch", Silence: "10m"},
+		{Type: "stream", Silence: "10 minutes"},
+		{Type: "stream", Silence: "10m", RecId: "some_id"},
+		{Type: "stream", Silence: "10m", Clock: "real"},
+	}
+	for _, tst := range invalid {
+		tst.Validate()
+		if tst.Result.Error != true {
+			t.Error("Test configuration with silence is invalid: ", tst)
+		}
+	}
+}
+
+func TestValidateReplayedDeadman(t *testing.T) {
+	script := "stream\n    |from()\n        .measurement('cpu')\n    |deadman(1.0, 5m)"
+	invalid := []Test{
+		{Type: "stream", Data: []string{"data1"}, Silence: "10m"},
+		{Type: "stream", Data: []string{"data1"}, Clock: "fast"},
+		{Type: "stream", RecId: "some_id"},
+	}
+	for _, tst := range invalid {
+		tst.Task.Script = script
+		tst.Validate()
+		if tst.Result.Error != true {
+			t.Error("Replayed test of a deadman() script should be invalid: ", tst)
+		}
+	}
+
+	tst := Test{Type: "stream", Data: []string{"data1"}}
+	tst.Task.Script = script
+	tst.Validate()
+	if tst.Result.Error != false {
+		t.Error("Test of a deadman() script written in real time should be valid: ", tst.Result)
+	}
+}
+
+func TestTaskId(t *testing.T) {
+	tst := NewTest()
+	tst.TaskName = "alert_weather.tick"
+	if tst.taskId() != "alert_weather.tick" {
+		t.Error("Task id should default to the script name, got ", tst.taskId())
+	}
+
+	tst.Id = "kapacitor-unit-jc2x1a9-0"
+	if tst.taskId() != tst.Id {
+		t.Error("Task id should be the test id, got ", tst.taskId())
+	}
+	if tst.String() != "TEST  (alert_weather.tick) " {
+		t.Error("Test output should report the script name, got ", tst.String())
+	}
+}
+
+func TestValidateTimeout(t *testing.T) {
+	tst := NewTest()
+	tst.Timeout = "1 minute"
+
+	tst.Validate()
+
+	if tst.Result.Error != true {
+		t.Error("Test configuration with invalid timeout is invalid")
+	}
+
+	tst = NewTest()
+	tst.Timeout = "1m"
+	if d, _ := tst.timeout(); d != time.Minute {
+		t.Error("Timeout should be 1m, got ", d)
+	}
+}
+
+func TestTimeoutString(t *testing.T) {
+	tst := NewTest()
+	tst.Name = "test"
+	tst.TaskName = "alert.tick"
+	tst.Result = Result{Message: timeoutMessage(&tst), Timeout: true}
+
+	if !strings.HasPrefix(tst.String(), "TEST test (alert.tick) TIMEOUT: timed out") {
+		t.Error("Timeout not reported as expected: ", tst.String())
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	tst := Test{
+		Name:         "test",
+		Id:           "kapacitor-unit-jc2x1a9-0",
+		TemplateName: "alert_weather_template.tick",
+		Type:         "stream",
+		Clock:        "fast",
+		Db:           "weather",
+	}
+	exp := "Kept artifacts of test test: task kapacitor-unit-jc2x1a9-0, " +
+		"template kapacitor-unit-jc2x1a9-0, recording kapacitor-unit-jc2x1a9-0-recording, " +
+		"replay kapacitor-unit-jc2x1a9-0-replay, database weather"
+	if tst.artifacts() != exp {
+		t.Error("Artifacts should be ", exp, " got ", tst.artifacts())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tst := Test{
+		Id:       "kapacitor-unit-jc2x1a9-0",
+		TaskName: "alert.tick",
+		Type:     "batch",
+		Db:       "weather",
+		Rp:       "default",
+		Task:     task.Task{Script: "batch\n|query('SELECT * FROM cpu')\n.every(1m)"},
+	}
+	defs, err := tst.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"dbrps":[{"db":"weather","rp":"default"}],"id":"kapacitor-unit-jc2x1a9-0",` +
+		`"script":"batch\n|query('SELECT * FROM cpu')\n.every(1s)","status":"enabled","type":"batch"}`
+	if len(defs) != 1 || defs[0] != exp {
+		t.Error("Dry run should print ", exp, " got ", defs)
+	}
+}
+
+func TestDryRunTemplate(t *testing.T) {
+	tst := Test{
+		Id:           "kapacitor-unit-jc2x1a9-0",
+		TemplateName: "alert_template.tick",
+		Vars:         map[string]Var{"crit": {Type: "float", Value: 80.0}},
+		Type:         "stream",
+		Db:           "weather",
+		Rp:           "default",
+		Task:         task.Task{Script: "dbrp \"weather\".\"default\"\nstream"},
+	}
+	defs, err := tst.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 2 {
+		t.Fatal("Dry run should print the template and the task, got ", defs)
+	}
+	if !strings.Contains(defs[0], `"id":"kapacitor-unit-jc2x1a9-0"`) || !strings.Contains(defs[0], `"type":"stream"`) {
+		t.Error("Unexpected template definition: ", defs[0])
+	}
+	exp := `{"id":"kapacitor-unit-jc2x1a9-0","status":"enabled","template-id":"kapacitor-unit-jc2x1a9-0",` +
+		`"vars":{"crit":{"type":"float","value":80}}}`
+	if defs[1] != exp {
+		t.Error("Dry run should print ", exp, " got ", defs[1])
+	}
+}
+
+func TestRunTearsDownOnError(t *testing.T) {
+	defer gock.Off()
+	h := "http://test:9093"
+	k := io.NewKapacitor(h)
+	i := io.NewInfluxdb(h)
+
+	gock.New(h).
+		Post("/kapacitor/v1/tasks").
+		Reply(200)
+	gock.New(h).
+		Post("/kapacitor/v1/write").
+		Reply(204)
+	gock.New(h).
+		Get("/kapacitor/v1/tasks/kapacitor-unit-0").
+		Reply(404).
+		JSON([]byte(`{"error": "no task exists"}`))
+	gock.New(h).
+		Delete("/kapacitor/v1/tasks/kapacitor-unit-0").
+		Reply(204)
+
+	tst := Test{Name: "test", Id: "kapacitor-unit-0", TaskName: "a.tick", Type: "stream", Data: []string{"cpu value=1"}}
+	err := tst.Run(k, i)
+	if err == nil {
+		t.Error("Run should return the task stats error")
+	}
+	if !gock.IsDone() {
+		t.Error("Task should be deleted when the test fails")
+	}
+}
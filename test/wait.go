@@ -0,0 +1,167 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/gpestana/kapacitor-unit/io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Interval between requests for the task node stats while waiting for the
+// test data to be processed
+const pollInterval = 100 * time.Millisecond
+
+// Returned when the test data is not processed before the test timeout
+var errTimeout = errors.New("timed out waiting for the task to process the test data")
+
+// Waits until the task processed the test data, by polling the task node
+// stats until the number of written points was received and the stats
+// settled. Fails with errTimeout if that does not happen before the test
+// timeout.
+func (t *Test) wait(k io.StatsReader) error {
+	return t.waitFor(k, len(t.Data))
+}
+
+// Waits until the task received the given number of points, counted since the
+// task was loaded, and the alerts settled
+func (t *Test) waitFor(k io.StatsReader, points int) error {
+	timeout, err := t.timeout()
+	if err != nil {
+		return err
+	}
+	glog.Info("DEBUG:: waiting for task ", t.taskId(), " to process ", points, " points")
+
+	p := newPoller(t.Type, points)
+	deadline := time.Now().Add(timeout)
+	for {
+		s, err := t.nodeStats(k)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if p.done(s, now) {
+			return nil
+		}
+		if now.After(deadline) {
+			return errTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Returns the node stats of the task the test data is written to, including
+// the alert nodes of the downstream tasks of a multi-task test
+func (t *Test) nodeStats(k io.StatsReader) (map[string]map[string]int, error) {
+	s, err := k.NodeStats(t.taskId())
+	if err != nil {
+		return nil, err
+	}
+	for j := range t.downstream() {
+		id := t.chainedTaskId(j + 1)
+		ds, err := k.NodeStats(id)
+		if err != nil {
+			return nil, err
+		}
+		for node, v := range ds {
+			if strings.HasPrefix(node, "alert") {
+				s[node+"@"+id] = v
+			}
+		}
+	}
+	return s, nil
+}
+
+// Returns the test timeout, if defined, or the default timeout
+func (t *Test) timeout() (time.Duration, error) {
+	if t.Timeout == "" {
+		return DefaultTimeout, nil
+	}
+	return parseDuration(t.Timeout)
+}
+
+// Timeout of the tests that do not define one
+var DefaultTimeout = 30 * time.Second
+
+// Decides if a task finished processing the test data from its node stats
+type poller struct {
+	typ    string
+	points int
+	// time the stats must not change after all points were received
+	settle time.Duration
+
+	last    map[string]map[string]int
+	changed time.Time
+}
+
+func newPoller(typ string, points int) *poller {
+	p := &poller{typ: typ, points: points, settle: 3 * pollInterval}
+	// Batch queries run every second, so alerts settle after the next query
+	if typ == "batch" {
+		p.settle = time.Second + pollInterval
+	}
+	return p
+}
+
+// Checks if the data was processed given the current node stats. Until all
+// points are received the task is still processing, however long the stats
+// stay unchanged.
+func (p *poller) done(stats map[string]map[string]int, now time.Time) bool {
+	s := p.settling(stats)
+	if p.last == nil || !reflect.DeepEqual(s, p.last) || p.received(stats) < p.points {
+		p.changed = now
+	}
+	p.last = s
+	return now.Sub(p.changed) >= p.settle
+}
+
+// Returns the stats that must settle. The query of a batch task runs every
+// second, which updates the counters of every node on each run, so only the
+// alerts are compared for batch tasks.
+func (p *poller) settling(stats map[string]map[string]int) map[string]map[string]int {
+	if p.typ == "batch" {
+		return map[string]map[string]int{"alerts": alertCounts(stats)}
+	}
+	return stats
+}
+
+// Returns the number of test data points received by the task, i.e. collected
+// by the stream node or queried by the batch query nodes. The batch test data
+// is written inside the window of a single query run, which may aggregate it,
+// so it is all received once a query returned points.
+func (p *poller) received(stats map[string]map[string]int) int {
+	n := 0
+	for node, s := range stats {
+		switch {
+		case p.typ == "batch" && strings.HasPrefix(node, "query") && s["points_queried"] > 0:
+			return p.points
+		case p.typ != "batch" && strings.HasPrefix(node, "stream"):
+			n += s["collected"]
+		}
+	}
+	return n
+}
+
+// Sums the alerts triggered by all alert nodes of a task
+func alertCounts(stats map[string]map[string]int) map[string]int {
+	f := make(map[string]int)
+	for node, s := range stats {
+		if !strings.HasPrefix(node, "alert") {
+			continue
+		}
+		for k, v := range s {
+			if strings.HasSuffix(k, "_triggered") {
+				f[k] += v
+			}
+		}
+	}
+	return f
+}
+
+// Message of the result of a test that timed out
+func timeoutMessage(t *Test) string {
+	timeout, _ := t.timeout()
+	return fmt.Sprintf("%v after %v", errTimeout, timeout)
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollerStreamReceived(t *testing.T) {
+	p := newPoller("stream", 2)
+	now := time.Now()
+
+	s := map[string]map[string]int{
+		"stream0": {"collected": 1},
+		"alert2":  {"collected": 1, "warns_triggered": 0},
+	}
+	if p.done(s, now) {
+		t.Error("Should not be done before all points are received")
+	}
+
+	s = map[string]map[string]int{
+		"stream0": {"collected": 2},
+		"alert2":  {"collected": 2, "warns_triggered": 1},
+	}
+	if p.done(s, now.Add(pollInterval)) {
+		t.Error("Should not be done before alerts settle")
+	}
+	if !p.done(s, now.Add(4*pollInterval)) {
+		t.Error("Should be done after all points are received and alerts settle")
+	}
+}
+
+func TestPollerBatchReceived(t *testing.T) {
+	p := newPoller("batch", 2)
+	now := time.Now()
+
+	s := map[string]map[string]int{
+		"query1": {"points_queried": 2, "batches_queried": 1},
+		"alert2": {"crits_triggered": 1},
+	}
+	if p.done(s, now) {
+		t.Error("Should not be done before the next batch query")
+	}
+	s = map[string]map[string]int{
+		"query1": {"points_queried": 4, "batches_queried": 2},
+		"alert2": {"crits_triggered": 1},
+	}
+	if !p.done(s, now.Add(time.Second+pollInterval)) {
+		t.Error("Should be done after alerts settle over a batch query")
+	}
+}
+
+func TestPollerBatchNoAlerts(t *testing.T) {
+	p := newPoller("batch", 3)
+	now := time.Now()
+
+	s := map[string]map[string]int{
+		"query1": {"points_queried": 1, "batches_queried": 1},
+		"alert2": {"collected": 1, "crits_triggered": 0},
+	}
+	p.done(s, now)
+	s = map[string]map[string]int{
+		"query1": {"points_queried": 2, "batches_queried": 2},
+		"alert2": {"collected": 2, "crits_triggered": 0},
+	}
+	if !p.done(s, now.Add(time.Second+pollInterval)) {
+		t.Error("Should be done when alerts settle while queries keep running")
+	}
+}
+
+func TestPollerNotReceived(t *testing.T) {
+	p := newPoller("stream", 5)
+	now := time.Now()
+
+	s := map[string]map[string]int{
+		"stream0": {"collected": 3},
+	}
+	for _, d := range []time.Duration{0, time.Second, time.Minute} {
+		if p.done(s, now.Add(d)) {
+			t.Error("Should not be done before all points are received")
+		}
+	}
+}
+
+func TestAlertCounts(t *testing.T) {
+	s := map[string]map[string]int{
+		"stream0": {"collected": 3},
+		"alert2":  {"collected": 3, "crits_triggered": 1, "warns_triggered": 1},
+		"alert4":  {"collected": 3, "crits_triggered": 1},
+	}
+	a := alertCounts(s)
+	if len(a) != 2 || a["crits_triggered"] != 2 || a["warns_triggered"] != 1 {
+		t.Error("Unexpected alert counts: ", a)
+	}
+}
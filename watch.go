@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gpestana/kapacitor-unit/cli"
+	"github.com/gpestana/kapacitor-unit/io"
+	"github.com/gpestana/kapacitor-unit/test"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Interval between checks for changes in the watched files
+const watchInterval = 500 * time.Millisecond
+
+// Modification times of the watched files, by path
+type snapshot map[string]time.Time
+
+// Runs the tests and then reruns the tests affected by changes in the
+// TICKscripts or test configuration files, printing a summary of the latest
+// result of every test after each run. Returns when the context is cancelled.
+func watch(ctx context.Context, f *cli.Config, k io.TaskBackend, i io.DataBackend) {
+	latest := make(results)
+	files := watchedFiles(f.ScriptsDir, f.TestsPath)
+	changed := []string{}
+	for {
+		tests, err := loadTests(f)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			rerun := tests
+			if len(changed) > 0 {
+				rerun = affectedTests(tests, changed, f.ScriptsDir)
+			}
+			fmt.Print("\033[H\033[2J")
+			if len(changed) > 0 {
+				fmt.Println("Changed:", changed)
+			}
+			start := time.Now()
+			runSuite(ctx, rerun, k, i, f)
+			fmt.Println()
+			fmt.Println(summarize(latest.update(tests, rerun), time.Since(start)))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Watching for changes...")
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchInterval):
+			}
+			cur := watchedFiles(f.ScriptsDir, f.TestsPath)
+			changed = changedFiles(files, cur)
+			files = cur
+			if len(changed) > 0 {
+				break
+			}
+		}
+	}
+}
+
+// Returns the modification times of the TICKscripts and test configuration
+// files
+func watchedFiles(scriptsDir string, testsPath string) snapshot {
+	s := make(snapshot)
+	add := func(exts ...string) filepath.WalkFunc {
+		return func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			for _, ext := range exts {
+				if filepath.Ext(path) == ext {
+					s[filepath.Clean(path)] = info.ModTime()
+				}
+			}
+			return nil
+		}
+	}
+	filepath.Walk(scriptsDir, add(".tick"))
+	filepath.Walk(testsPath, add(".yml", ".yaml"))
+	return s
+}
+
+// Returns the files that were added, changed or deleted between snapshots
+func changedFiles(old snapshot, cur snapshot) []string {
+	changed := []string{}
+	for p, t := range cur {
+		if ot, ok := old[p]; !ok || !ot.Equal(t) {
+			changed = append(changed, p)
+		}
+	}
+	for p := range old {
+		if _, ok := cur[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Selects the tests defined in a changed configuration file or testing a
+// changed TICKscript
+func affectedTests(tests TestCollection, changed []string, scriptsDir string) TestCollection {
+	c := make(map[string]bool)
+	for _, p := range changed {
+		c[filepath.Clean(p)] = true
+	}
+	affected := TestCollection{}
+	for _, t := range tests {
+		if c[filepath.Clean(t.File)] {
+			affected = append(affected, t)
+			continue
+		}
+		for _, n := range t.ScriptNames() {
+			if c[filepath.Join(scriptsDir, n)] {
+				affected = append(affected, t)
+				break
+			}
+		}
+	}
+	return affected
+}
+
+// Latest result of each test, by configuration file and test name
+type results map[string]test.Test
+
+// Saves the results of the tests that ran and drops the results of the tests
+// that do not exist anymore. Returns the latest results of all tests.
+func (r results) update(tests TestCollection, ran TestCollection) TestCollection {
+	for _, t := range ran {
+		r[resultKey(t)] = t
+	}
+	latest := TestCollection{}
+	exists := make(map[string]bool)
+	for _, t := range tests {
+		k := resultKey(t)
+		exists[k] = true
+		if res, ok := r[k]; ok {
+			latest = append(latest, res)
+		}
+	}
+	for k := range r {
+		if !exists[k] {
+			delete(r, k)
+		}
+	}
+	return latest
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/gpestana/kapacitor-unit/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	d, err := ioutil.TempDir("", "kapacitor-unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	for _, f := range []string{"alert.tick", "notes.txt", "tests.yaml"} {
+		createConfFile(filepath.Join(d, f), "")
+	}
+
+	s := watchedFiles(d, filepath.Join(d, "tests.yaml"))
+
+	if len(s) != 2 {
+		t.Error("Only TICKscripts and test configurations should be watched: ", s)
+	}
+	if _, ok := s[filepath.Join(d, "alert.tick")]; !ok {
+		t.Error("TICKscript should be watched: ", s)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	now := time.Now()
+	old := snapshot{"a.tick": now, "b.tick": now, "c.yaml": now}
+	cur := snapshot{"a.tick": now, "b.tick": now.Add(time.Second), "d.yaml": now}
+
+	changed := changedFiles(old, cur)
+
+	exp := []string{"b.tick", "c.yaml", "d.yaml"}
+	if !reflect.DeepEqual(changed, exp) {
+		t.Error("Changed files should be ", exp, " got ", changed)
+	}
+}
+
+func TestAffectedTests(t *testing.T) {
+	tests := TestCollection{
+		{Name: "1", File: "tests/a.yaml", TaskName: "a.tick"},
+		{Name: "2", File: "tests/b.yaml", TaskName: "b.tick"},
+		{Name: "3", File: "tests/c.yaml", TemplateName: "c.tick"},
+	}
+
+	affected := affectedTests(tests, []string{"tests/a.yaml", "scripts/c.tick"}, "scripts")
+
+	if len(affected) != 2 || affected[0].Name != "1" || affected[1].Name != "3" {
+		t.Error("Unexpected affected tests: ", affected)
+	}
+}
+
+func TestResultsUpdate(t *testing.T) {
+	r := make(results)
+	tests := TestCollection{
+		{Name: "1", File: "a.yaml"},
+		{Name: "2", File: "a.yaml"},
+	}
+	ran := TestCollection{
+		{Name: "1", File: "a.yaml", Result: test.Result{Passed: true}},
+		{Name: "2", File: "a.yaml", Result: test.Result{Passed: false}},
+	}
+	latest := r.update(tests, ran)
+	if len(latest) != 2 || !latest[0].Result.Passed || latest[1].Result.Passed {
+		t.Error("Unexpected latest results: ", latest)
+	}
+
+	// test 2 is fixed, test 1 is removed and test 3 is added
+	tests = TestCollection{
+		{Name: "2", File: "a.yaml"},
+		{Name: "3", File: "a.yaml"},
+	}
+	ran = TestCollection{
+		{Name: "2", File: "a.yaml", Result: test.Result{Passed: true}},
+		{Name: "3", File: "a.yaml", Result: test.Result{Passed: true}},
+	}
+	latest = r.update(tests, ran)
+	if len(latest) != 2 || latest[0].Name != "2" || !latest[0].Result.Passed || len(r) != 2 {
+		t.Error("Unexpected latest results: ", latest)
+	}
+}